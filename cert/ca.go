@@ -0,0 +1,232 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/appremon/apprecert/config"
+	"github.com/appremon/apprecert/utils"
+)
+
+// CAOptions controls how the root or intermediate CA is created.
+type CAOptions struct {
+	Force    bool    // overwrite an existing CA in CAROOT
+	KeyType  KeyType // CA key algorithm, DefaultCAKeyType if empty
+	Validity         // lifetime, DefaultCADays or DefaultIntermediateDays if unset
+
+	// LeafKeyType is remembered as the default leaf key algorithm of a new
+	// root CA; DefaultLeafKeyType if empty, whatever the CA's algorithm.
+	LeafKeyType KeyType
+
+	// NameConstraints limits the names the root CA may certify.
+	NameConstraints *config.NameConstraints
+
+	// NoPassphrase stores the CA key unencrypted.
+	NoPassphrase bool
+}
+
+// newKeyPassphrase returns the passphrase to encrypt a new CA key with, or
+// nil when opts.NoPassphrase is set.
+func newKeyPassphrase(cfg *config.Config, opts CAOptions) ([]byte, error) {
+	if opts.NoPassphrase {
+		return nil, nil
+	}
+	pass, err := cfg.NewPassphrase()
+	if err != nil {
+		return nil, fmt.Errorf("%w (or use -no-passphrase)", err)
+	}
+	return pass, nil
+}
+
+// CreateCA generates a self-signed root CA and writes it to CAROOT.
+func CreateCA(cfg *config.Config, opts CAOptions) error {
+	if err := cfg.EnsureCAROOT(); err != nil {
+		return fmt.Errorf("failed to create CAROOT: %w", err)
+	}
+
+	certPath := filepath.Join(cfg.CAROOT, config.RootCertFile)
+	keyPath := filepath.Join(cfg.CAROOT, config.RootKeyFile)
+	if !opts.Force && (utils.PathExists(certPath) || utils.PathExists(keyPath)) {
+		return fmt.Errorf("a CA already exists in %s (use -force to replace it)", cfg.CAROOT)
+	}
+
+	passphrase, err := newKeyPassphrase(cfg, opts)
+	if err != nil {
+		return err
+	}
+
+	keyType := opts.KeyType
+	if keyType == "" {
+		keyType = DefaultCAKeyType
+	}
+	privKey, err := GenerateKey(keyType)
+	if err != nil {
+		return fmt.Errorf("failed to generate CA key: %w", err)
+	}
+	pub := privKey.(crypto.Signer).Public()
+
+	skid, err := subjectKeyID(pub)
+	if err != nil {
+		return err
+	}
+
+	notBefore, notAfter, err := opts.window(DefaultCADays)
+	if err != nil {
+		return err
+	}
+
+	owner := userAndHostname()
+	tpl := &x509.Certificate{
+		SerialNumber: randomSerialNumber(),
+		Subject: pkix.Name{
+			Organization:       []string{"Apprecert Development CA"},
+			OrganizationalUnit: []string{owner},
+			CommonName:         "apprecert " + owner,
+		},
+		SubjectKeyId:          skid,
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            1, // allow a single intermediate CA
+		SignatureAlgorithm:    signatureAlgorithm(pub),
+	}
+	if err := applyNameConstraints(tpl, opts.NameConstraints); err != nil {
+		return err
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, tpl, tpl, pub, privKey)
+	if err != nil {
+		return fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+
+	if err := savePrivateKey(privKey, keyPath, passphrase); err != nil {
+		return err
+	}
+	if err := GenerateMultipleFormats(cfg, certBytes); err != nil {
+		return err
+	}
+
+	// An intermediate signed by the previous root is no longer valid
+	for _, name := range []string{config.IntermediateCertFile, config.IntermediateKeyFile} {
+		if err := os.Remove(filepath.Join(cfg.CAROOT, name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove stale intermediate CA: %w", err)
+		}
+	}
+
+	// Remember the algorithms; leaves do not inherit the CA's, since browsers
+	// reject some of them, such as Ed25519, for TLS
+	cfg.CAKeyType = string(keyType)
+	cfg.KeyType = string(opts.LeafKeyType)
+	cfg.NameConstraints = nil
+	if opts.NameConstraints != nil && !opts.NameConstraints.Empty() {
+		cfg.NameConstraints = opts.NameConstraints
+	}
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	log.Printf("Created a new local CA in %s\n", cfg.CAROOT)
+	return nil
+}
+
+// CreateIntermediate generates an intermediate CA signed by the root CA and
+// writes it to CAROOT. Once it exists, leaves are issued from the intermediate
+// and the root key may be moved off the machine.
+func CreateIntermediate(cfg *config.Config, opts CAOptions) error {
+	certPath := filepath.Join(cfg.CAROOT, config.IntermediateCertFile)
+	keyPath := filepath.Join(cfg.CAROOT, config.IntermediateKeyFile)
+	if !opts.Force && (utils.PathExists(certPath) || utils.PathExists(keyPath)) {
+		return fmt.Errorf("an intermediate CA already exists in %s (use -force to replace it)", cfg.CAROOT)
+	}
+
+	rootCert, rootKey, err := cfg.LoadCA()
+	if err != nil {
+		return fmt.Errorf("failed to load root CA: %w", err)
+	}
+	rootSigner, ok := rootKey.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("CA key does not implement crypto.Signer")
+	}
+	if rootCert.MaxPathLen == 0 && rootCert.MaxPathLenZero {
+		return fmt.Errorf("the root CA does not allow intermediates (path length 0); recreate it with 'ca init -force'")
+	}
+
+	passphrase, err := newKeyPassphrase(cfg, opts)
+	if err != nil {
+		return err
+	}
+
+	keyType := opts.KeyType
+	if keyType == "" && cfg.CAKeyType != "" {
+		keyType = KeyType(cfg.CAKeyType)
+	}
+	if keyType == "" {
+		keyType = DefaultCAKeyType
+	}
+	privKey, err := GenerateKey(keyType)
+	if err != nil {
+		return fmt.Errorf("failed to generate intermediate CA key: %w", err)
+	}
+	pub := privKey.(crypto.Signer).Public()
+
+	skid, err := subjectKeyID(pub)
+	if err != nil {
+		return err
+	}
+
+	notBefore, notAfter, err := opts.window(DefaultIntermediateDays)
+	if err != nil {
+		return err
+	}
+	notBefore, notAfter = clampToIssuer(notBefore, notAfter, rootCert)
+
+	owner := userAndHostname()
+	tpl := &x509.Certificate{
+		SerialNumber: randomSerialNumber(),
+		Subject: pkix.Name{
+			Organization:       []string{"Apprecert Development CA"},
+			OrganizationalUnit: []string{owner},
+			CommonName:         "apprecert intermediate " + owner,
+		},
+		SubjectKeyId:          skid,
+		AuthorityKeyId:        rootCert.SubjectKeyId,
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		SignatureAlgorithm:    signatureAlgorithm(rootSigner.Public()),
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, tpl, rootCert, pub, rootSigner)
+	if err != nil {
+		return fmt.Errorf("failed to create intermediate CA certificate: %w", err)
+	}
+	if err := verifyCertificate(certBytes, rootCert, nil); err != nil {
+		return err
+	}
+
+	if err := savePrivateKey(privKey, keyPath, passphrase); err != nil {
+		return err
+	}
+	if err := savePEM(certBytes, certPath); err != nil {
+		return fmt.Errorf("failed to write intermediate CA certificate: %w", err)
+	}
+	// rootCA.p12 of older versions also holds the root key
+	if err := saveTrustStoreP12(rootCert, filepath.Join(cfg.CAROOT, "rootCA.p12")); err != nil {
+		return fmt.Errorf("failed to update rootCA.p12: %w", err)
+	}
+
+	log.Printf("Created a new intermediate CA in %s\n", cfg.CAROOT)
+	log.Printf("Leaf certificates are now issued from the intermediate; %s can be moved offline\n", config.RootKeyFile)
+	return nil
+}
@@ -3,8 +3,10 @@ package cert
 import (
 	"crypto"
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
 	"log"
 	"time"
@@ -12,43 +14,228 @@ import (
 	"github.com/appremon/apprecert/config"
 )
 
-func Generate(cfg *config.Config, hosts []string) error {
-    caCert, caKey, err := cfg.LoadCA()
-    if err != nil {
-        return fmt.Errorf("failed to load CA: %w", err)
-    }
+// Options controls how a leaf certificate is issued.
+type Options struct {
+	Server     bool    // add the serverAuth extended key usage
+	Client     bool    // add the clientAuth extended key usage
+	CommonName string  // subject common name, e.g. a client identity
+	P12        bool    // also write a PKCS#12 bundle
+	KeyType    KeyType // leaf key algorithm, the CAROOT leaf default if empty
+	Validity           // lifetime, DefaultLeafDays if unset
 
-    // Assert that caKey implements crypto.Signer
-    signer, ok := caKey.(crypto.Signer)
-    if !ok {
-        return fmt.Errorf("CA key does not implement crypto.Signer")
-    }
+	// StrictLifetime refuses server certificates valid for more than
+	// MaxLeafDays instead of only warning.
+	StrictLifetime bool
+}
+
+// extKeyUsage returns the extended key usages requested by opts.
+// A certificate is a server certificate unless only Client is set.
+func (opts Options) extKeyUsage() []x509.ExtKeyUsage {
+	var usages []x509.ExtKeyUsage
+	if opts.Server || !opts.Client {
+		usages = append(usages, x509.ExtKeyUsageServerAuth)
+	}
+	if opts.Client {
+		usages = append(usages, x509.ExtKeyUsageClientAuth)
+	}
+	return usages
+}
+
+// Generate issues a certificate for hosts, signed by the CA in CAROOT.
+// Hosts may be DNS names, IP addresses, email addresses or URIs.
+func Generate(cfg *config.Config, hosts []string, opts Options) error {
+	certBytes, privKey, chain, err := newLeaf(cfg, hosts, opts)
+	if err != nil {
+		return err
+	}
+
+	// Save to disk
+	err = saveCertificate(cfg, certBytes, privKey, chain, hosts, opts)
+	if err != nil {
+		return err
+	}
+
+	if len(hosts) > 0 {
+		log.Printf("Certificate created for hosts: %v\n", hosts)
+	} else {
+		log.Printf("Certificate created for %q\n", opts.CommonName)
+	}
+	return nil
+}
+
+// Issued is a certificate returned by Issue instead of being saved.
+type Issued struct {
+	CertPEM []byte // the leaf followed by any intermediate CA
+	KeyPEM  []byte // the unencrypted leaf key
+	RootPEM []byte // the root CA
+}
+
+// Issue issues a certificate like Generate, but returns it in PEM form
+// instead of writing it into CAROOT, e.g. to publish it as a Kubernetes
+// Secret.
+func Issue(cfg *config.Config, hosts []string, opts Options) (*Issued, error) {
+	if opts.P12 {
+		return nil, fmt.Errorf("cannot write a PKCS#12 bundle without saving the certificate")
+	}
+	certBytes, privKey, chain, err := newLeaf(cfg, hosts, opts)
+	if err != nil {
+		return nil, err
+	}
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(privKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %w", err)
+	}
+
+	issued := &Issued{
+		CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}),
+		KeyPEM:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}),
+		RootPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: chain[len(chain)-1].Raw}),
+	}
+	for _, c := range chain[:len(chain)-1] {
+		issued.CertPEM = append(issued.CertPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	return issued, nil
+}
+
+// newLeaf generates a key pair for hosts and issues its certificate. It
+// returns the DER certificate, the key and the chain up to the root.
+func newLeaf(cfg *config.Config, hosts []string, opts Options) ([]byte, crypto.PrivateKey, []*x509.Certificate, error) {
+	if len(hosts) == 0 && opts.CommonName == "" {
+		return nil, nil, nil, fmt.Errorf("at least one host or a common name is required")
+	}
+
+	// Generate the leaf key pair
+	keyType := opts.KeyType
+	if keyType == "" && cfg.KeyType != "" {
+		keyType = KeyType(cfg.KeyType)
+	}
+	if keyType == "" {
+		keyType = DefaultLeafKeyType
+	}
+	privKey, err := GenerateKey(keyType)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to generate private key: %w", err)
+	}
+	pub := privKey.(crypto.Signer).Public()
+
+	certBytes, chain, err := issue(cfg, pub, hosts, opts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return certBytes, privKey, chain, nil
+}
+
+// issue signs a leaf certificate for pub and hosts with the issuing CA in
+// CAROOT and verifies the result. It returns the DER certificate and its chain
+// up to and including the root.
+func issue(cfg *config.Config, pub crypto.PublicKey, hosts []string, opts Options) ([]byte, []*x509.Certificate, error) {
+	caCert, caKey, rootCert, err := cfg.LoadIssuer()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load CA: %w", err)
+	}
+	chain := []*x509.Certificate{caCert}
+	if caCert != rootCert {
+		chain = append(chain, rootCert)
+	}
+
+	// Assert that caKey implements crypto.Signer
+	signer, ok := caKey.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("CA key does not implement crypto.Signer")
+	}
+
+	skid, err := subjectKeyID(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyUsage := x509.KeyUsageDigitalSignature
+	if _, isRSA := pub.(*rsa.PublicKey); isRSA {
+		keyUsage |= x509.KeyUsageKeyEncipherment
+	}
+
+	notBefore, notAfter, err := opts.window(DefaultLeafDays)
+	if err != nil {
+		return nil, nil, err
+	}
+	notBefore, notAfter = clampToIssuer(notBefore, notAfter, caCert)
+	if err := checkLifetime(notBefore, notAfter, opts); err != nil {
+		return nil, nil, err
+	}
 
 	// Generate certificate template
 	certTpl := &x509.Certificate{
 		SerialNumber: randomSerialNumber(),
 		Subject: pkix.Name{
-			Organization: []string{"Apprecert Development Certificate"},
+			Organization:       []string{"Apprecert Development Certificate"},
+			OrganizationalUnit: []string{userAndHostname()},
+			CommonName:         opts.CommonName,
 		},
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(2, 3, 0),
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		SubjectKeyId:          skid,
+		AuthorityKeyId:        caCert.SubjectKeyId,
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              keyUsage,
+		ExtKeyUsage:           opts.extKeyUsage(),
 		BasicConstraintsValid: true,
+		SignatureAlgorithm:    signatureAlgorithm(signer.Public()),
+	}
+	if err := addSANs(certTpl, hosts); err != nil {
+		return nil, nil, err
+	}
+	if err := checkNameConstraints(certTpl, chain); err != nil {
+		return nil, nil, err
 	}
 
 	// Generate certificate
-	certBytes, err := x509.CreateCertificate(rand.Reader, certTpl, caCert, signer.Public(), signer)
+	certBytes, err := x509.CreateCertificate(rand.Reader, certTpl, caCert, pub, signer)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	// Save to disk
-	err = saveCertificate(cfg, certBytes, hosts)
-	if err != nil {
-		return err
+	if err := verifyCertificate(certBytes, rootCert, chain[:len(chain)-1]); err != nil {
+		return nil, nil, err
 	}
+	return certBytes, chain, nil
+}
 
-	log.Printf("Certificate created for hosts: %v\n", hosts)
+// checkLifetime warns about, or with StrictLifetime refuses, server
+// certificates that browsers reject for being valid too long.
+func checkLifetime(notBefore, notAfter time.Time, opts Options) error {
+	isServer := opts.Server || !opts.Client
+	if !isServer || notAfter.Sub(notBefore) <= MaxLeafDays*24*time.Hour {
+		return nil
+	}
+	days := int(notAfter.Sub(notBefore).Hours() / 24)
+	if opts.StrictLifetime {
+		return fmt.Errorf("certificate would be valid for %d days; Apple and Chrome reject server certificates valid for more than %d", days, MaxLeafDays)
+	}
+	log.Printf("Warning: certificate is valid for %d days; Apple and Chrome reject server certificates valid for more than %d\n", days, MaxLeafDays)
 	return nil
 }
 
+// verifyCertificate checks that an issued certificate chains to the root CA
+// through the given intermediates. It verifies as of the certificate's
+// NotBefore, so certificates that only become valid later pass.
+func verifyCertificate(certBytes []byte, rootCert *x509.Certificate, intermediates []*x509.Certificate) error {
+	leaf, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse issued certificate: %w", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(rootCert)
+	inters := x509.NewCertPool()
+	for _, c := range intermediates {
+		inters.AddCert(c)
+	}
+	usages := leaf.ExtKeyUsage
+	if len(usages) == 0 {
+		usages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+	opts := x509.VerifyOptions{Roots: roots, Intermediates: inters, KeyUsages: usages, CurrentTime: leaf.NotBefore}
+	if _, err := leaf.Verify(opts); err != nil {
+		return fmt.Errorf("issued certificate does not verify against the CA: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package cert
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/appremon/apprecert/config"
+)
+
+// newTestCA creates an unencrypted root CA in a temporary CAROOT.
+func newTestCA(t *testing.T, opts CAOptions) *config.Config {
+	t.Helper()
+	cfg := &config.Config{CAROOT: t.TempDir()}
+	opts.NoPassphrase = true
+	if err := CreateCA(cfg, opts); err != nil {
+		t.Fatalf("CreateCA: %v", err)
+	}
+	return cfg
+}
+
+// parseIssued returns the leaf certificate of an issued chain.
+func parseIssued(t *testing.T, issued *Issued) *x509.Certificate {
+	t.Helper()
+	block, _ := pem.Decode(issued.CertPEM)
+	if block == nil {
+		t.Fatal("no certificate in issued PEM")
+	}
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf
+}
+
+func TestIssueFutureNotBefore(t *testing.T) {
+	cfg := newTestCA(t, CAOptions{KeyType: ECDSAP256})
+	notBefore := time.Now().Add(30 * 24 * time.Hour).Truncate(time.Second)
+
+	issued, err := Issue(cfg, []string{"later.test"}, Options{Validity: Validity{NotBefore: notBefore, Days: 90}})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	leaf := parseIssued(t, issued)
+	if !leaf.NotBefore.Equal(notBefore) {
+		t.Fatalf("NotBefore %s, want %s", leaf.NotBefore, notBefore)
+	}
+	if want := notBefore.AddDate(0, 0, 90); !leaf.NotAfter.Equal(want) {
+		t.Fatalf("NotAfter %s, want %s", leaf.NotAfter, want)
+	}
+}
+
+func TestIssueBackdateWithinDays(t *testing.T) {
+	cfg := newTestCA(t, CAOptions{KeyType: ECDSAP256, Validity: Validity{Backdate: 48 * time.Hour}})
+
+	issued, err := Issue(cfg, []string{"skew.test"}, Options{Validity: Validity{Days: 30, Backdate: time.Hour}})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	leaf := parseIssued(t, issued)
+	if got := leaf.NotAfter.Sub(leaf.NotBefore); got != 30*24*time.Hour {
+		t.Fatalf("lifetime %s, want 30 days including the backdate", got)
+	}
+	if !leaf.NotBefore.Before(time.Now().Add(-59 * time.Minute)) {
+		t.Fatalf("NotBefore %s not backdated", leaf.NotBefore)
+	}
+}
+
+func TestLeafKeyTypeIsNotInheritedFromCA(t *testing.T) {
+	cfg := newTestCA(t, CAOptions{KeyType: Ed25519})
+	if cfg.CAKeyType != string(Ed25519) || cfg.KeyType != "" {
+		t.Fatalf("config key types %q/%q, want ed25519 for the CA only", cfg.CAKeyType, cfg.KeyType)
+	}
+
+	issued, err := Issue(cfg, []string{"app.test"}, Options{})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if alg := parseIssued(t, issued).PublicKeyAlgorithm; alg != x509.RSA {
+		t.Fatalf("leaf key %s, want the default RSA", alg)
+	}
+
+	// An intermediate defaults to the root's algorithm
+	if err := CreateIntermediate(cfg, CAOptions{NoPassphrase: true}); err != nil {
+		t.Fatalf("CreateIntermediate: %v", err)
+	}
+	inter, _, root, err := cfg.LoadIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inter == root || inter.PublicKeyAlgorithm != x509.Ed25519 {
+		t.Fatalf("intermediate CA key %s, want Ed25519", inter.PublicKeyAlgorithm)
+	}
+}
+
+func TestLeafKeyTypeDefault(t *testing.T) {
+	cfg := newTestCA(t, CAOptions{KeyType: ECDSAP384, LeafKeyType: ECDSAP256})
+
+	issued, err := Issue(cfg, []string{"app.test"}, Options{})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	leaf := parseIssued(t, issued)
+	if leaf.PublicKeyAlgorithm != x509.ECDSA || leaf.SignatureAlgorithm != x509.ECDSAWithSHA384 {
+		t.Fatalf("leaf key %s signed with %s, want ECDSA signed with ECDSA-SHA384", leaf.PublicKeyAlgorithm, leaf.SignatureAlgorithm)
+	}
+
+	issued, err = Issue(cfg, []string{"app.test"}, Options{KeyType: RSA2048})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if alg := parseIssued(t, issued).PublicKeyAlgorithm; alg != x509.RSA {
+		t.Fatalf("leaf key %s with -key-type rsa2048, want RSA", alg)
+	}
+}
@@ -0,0 +1,163 @@
+package cert
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/appremon/apprecert/config"
+)
+
+// LocalNameConstraints permits only names and addresses that cannot belong to
+// a public site: reserved TLDs, loopback and private ranges.
+func LocalNameConstraints() *config.NameConstraints {
+	return &config.NameConstraints{
+		PermittedDNS: []string{"localhost", "test", "local", "internal", "home.arpa"},
+		PermittedIPs: []string{
+			"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16",
+			"::1/128", "fc00::/7",
+		},
+	}
+}
+
+// applyNameConstraints copies name constraints into a CA certificate template.
+func applyNameConstraints(tpl *x509.Certificate, nc *config.NameConstraints) error {
+	if nc == nil || nc.Empty() {
+		return nil
+	}
+
+	var err error
+	tpl.PermittedDNSDomainsCritical = true
+	tpl.PermittedDNSDomains = nc.PermittedDNS
+	tpl.ExcludedDNSDomains = nc.ExcludedDNS
+	if tpl.PermittedIPRanges, err = parseCIDRs(nc.PermittedIPs); err != nil {
+		return err
+	}
+	if tpl.ExcludedIPRanges, err = parseCIDRs(nc.ExcludedIPs); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseCIDRs parses IP ranges in CIDR notation.
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var ranges []*net.IPNet
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP range %q: %w", cidr, err)
+		}
+		ranges = append(ranges, ipNet)
+	}
+	return ranges, nil
+}
+
+// checkNameConstraints refuses SANs that any CA in the chain may not certify,
+// so a constrained CA never signs a certificate clients would reject.
+func checkNameConstraints(tpl *x509.Certificate, chain []*x509.Certificate) error {
+	for _, ca := range chain {
+		for _, name := range tpl.DNSNames {
+			if !domainAllowed(name, ca.PermittedDNSDomains, ca.ExcludedDNSDomains) {
+				return fmt.Errorf("%q is outside the CA's name constraints", name)
+			}
+		}
+		for _, ip := range tpl.IPAddresses {
+			if !ipAllowed(ip, ca.PermittedIPRanges, ca.ExcludedIPRanges) {
+				return fmt.Errorf("%s is outside the CA's name constraints", ip)
+			}
+		}
+		for _, email := range tpl.EmailAddresses {
+			if !emailAllowed(email, ca.PermittedEmailAddresses, ca.ExcludedEmailAddresses) {
+				return fmt.Errorf("%q is outside the CA's name constraints", email)
+			}
+		}
+		for _, uri := range tpl.URIs {
+			if !domainAllowed(uri.Hostname(), ca.PermittedURIDomains, ca.ExcludedURIDomains) {
+				return fmt.Errorf("%q is outside the CA's name constraints", uri)
+			}
+		}
+	}
+	return nil
+}
+
+// domainAllowed applies RFC 5280 domain constraints: "example.test" matches
+// the domain and its subdomains, ".example.test" only its subdomains.
+func domainAllowed(name string, permitted, excluded []string) bool {
+	return nameAllowed(name, permitted, excluded, matchDomain)
+}
+
+// emailAllowed applies RFC 5280 email constraints: "user@example.test"
+// matches that mailbox, "example.test" every mailbox on that host, and
+// ".example.test" every mailbox on its subdomains.
+func emailAllowed(email string, permitted, excluded []string) bool {
+	return nameAllowed(email, permitted, excluded, matchEmail)
+}
+
+// nameAllowed reports whether name matches no excluded constraint and, if
+// there are permitted ones, at least one of those.
+func nameAllowed(name string, permitted, excluded []string, match func(name, constraint string) bool) bool {
+	for _, c := range excluded {
+		if match(name, c) {
+			return false
+		}
+	}
+	if len(permitted) == 0 {
+		return true
+	}
+	for _, c := range permitted {
+		if match(name, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDomain reports whether name falls under a domain constraint.
+func matchDomain(name, constraint string) bool {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	constraint = strings.ToLower(constraint)
+	if constraint == "" {
+		return true
+	}
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(name, constraint)
+	}
+	return name == constraint || strings.HasSuffix(name, "."+constraint)
+}
+
+// matchEmail reports whether the mailbox email falls under an email
+// constraint. The local part is compared exactly, the host case-insensitively.
+func matchEmail(email, constraint string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	local, host := email[:at], strings.ToLower(email[at+1:])
+	if i := strings.LastIndex(constraint, "@"); i >= 0 {
+		return local == constraint[:i] && host == strings.ToLower(constraint[i+1:])
+	}
+	constraint = strings.ToLower(constraint)
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(host, constraint)
+	}
+	return host == constraint
+}
+
+// ipAllowed applies IP range constraints.
+func ipAllowed(ip net.IP, permitted, excluded []*net.IPNet) bool {
+	for _, r := range excluded {
+		if r.Contains(ip) {
+			return false
+		}
+	}
+	if len(permitted) == 0 {
+		return true
+	}
+	for _, r := range permitted {
+		if r.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package cert
+
+import (
+	"crypto/x509"
+	"strings"
+	"testing"
+
+	"github.com/appremon/apprecert/config"
+)
+
+func TestMatchDomain(t *testing.T) {
+	for _, tc := range []struct {
+		name, constraint string
+		want             bool
+	}{
+		{"example.test", "example.test", true},
+		{"www.example.test", "example.test", true},
+		{"WWW.Example.Test.", "example.test", true},
+		{"badexample.test", "example.test", false},
+		{"example.test", ".example.test", false},
+		{"www.example.test", ".example.test", true},
+		{"anything.test", "", true},
+	} {
+		if got := matchDomain(tc.name, tc.constraint); got != tc.want {
+			t.Errorf("matchDomain(%q, %q) = %v, want %v", tc.name, tc.constraint, got, tc.want)
+		}
+	}
+}
+
+func TestMatchEmail(t *testing.T) {
+	for _, tc := range []struct {
+		email, constraint string
+		want              bool
+	}{
+		// A mailbox
+		{"user@example.test", "user@example.test", true},
+		{"user@EXAMPLE.test", "user@example.test", true},
+		{"other@example.test", "user@example.test", false},
+		{"User@example.test", "user@example.test", false},
+		{"user@sub.example.test", "user@example.test", false},
+		// A host
+		{"user@example.test", "example.test", true},
+		{"user@sub.example.test", "example.test", false},
+		// A domain
+		{"user@sub.example.test", ".example.test", true},
+		{"user@example.test", ".example.test", false},
+		{"user@badexample.test", ".example.test", false},
+	} {
+		if got := matchEmail(tc.email, tc.constraint); got != tc.want {
+			t.Errorf("matchEmail(%q, %q) = %v, want %v", tc.email, tc.constraint, got, tc.want)
+		}
+	}
+}
+
+func TestCheckNameConstraints(t *testing.T) {
+	ca := &x509.Certificate{
+		PermittedDNSDomains:     []string{"test"},
+		ExcludedDNSDomains:      []string{"prod.test"},
+		PermittedEmailAddresses: []string{"example.test", "ops@corp.test"},
+	}
+	for _, tc := range []struct {
+		hosts []string
+		want  string // part of the error, empty if allowed
+	}{
+		{[]string{"app.test", "127.0.0.1", "dev@example.test"}, ""},
+		{[]string{"app.example.com"}, "app.example.com"},
+		{[]string{"db.prod.test"}, "db.prod.test"},
+		{[]string{"ops@corp.test"}, ""},
+		{[]string{"dev@corp.test"}, "dev@corp.test"},
+		{[]string{"dev@sub.example.test"}, "dev@sub.example.test"},
+	} {
+		tpl := &x509.Certificate{}
+		if err := addSANs(tpl, tc.hosts); err != nil {
+			t.Fatal(err)
+		}
+		err := checkNameConstraints(tpl, []*x509.Certificate{ca})
+		switch {
+		case tc.want == "" && err != nil:
+			t.Errorf("%v: %v", tc.hosts, err)
+		case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+			t.Errorf("%v: got %v, want an error about %s", tc.hosts, err, tc.want)
+		}
+	}
+}
+
+func TestIssueOutsideNameConstraints(t *testing.T) {
+	cfg := newTestCA(t, CAOptions{KeyType: ECDSAP256, NameConstraints: &config.NameConstraints{PermittedDNS: []string{"test"}}})
+	if _, err := Issue(cfg, []string{"app.test"}, Options{}); err != nil {
+		t.Fatalf("Issue inside the constraints: %v", err)
+	}
+	if _, err := Issue(cfg, []string{"example.com"}, Options{}); err == nil {
+		t.Fatal("Issue succeeded outside the constraints")
+	}
+}
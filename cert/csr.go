@@ -0,0 +1,99 @@
+package cert
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/appremon/apprecert/config"
+)
+
+// minRSABits is the smallest RSA key accepted in a CSR.
+const minRSABits = 2048
+
+// LoadCSR reads a PEM or DER encoded certificate signing request.
+func LoadCSR(path string) (*x509.CertificateRequest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSR: %w", err)
+	}
+
+	der := data
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "CERTIFICATE REQUEST" && block.Type != "NEW CERTIFICATE REQUEST" {
+			return nil, fmt.Errorf("unexpected PEM type %q in CSR", block.Type)
+		}
+		der = block.Bytes
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSR: %w", err)
+	}
+	return csr, nil
+}
+
+// SignCSR issues a certificate for the public key in csr, signed by the CA in
+// CAROOT. Only the requested SANs and common name are copied from the CSR; key
+// usages and validity come from opts. No private key is written.
+func SignCSR(cfg *config.Config, csr *x509.CertificateRequest, opts Options) error {
+	if err := csr.CheckSignature(); err != nil {
+		return fmt.Errorf("invalid CSR signature: %w", err)
+	}
+	if opts.P12 {
+		return fmt.Errorf("cannot write a PKCS#12 bundle without the private key")
+	}
+
+	switch pub := csr.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSABits {
+			return fmt.Errorf("CSR RSA key is %d bits, at least %d are required", pub.N.BitLen(), minRSABits)
+		}
+	case *ecdsa.PublicKey, ed25519.PublicKey:
+	default:
+		return fmt.Errorf("unsupported CSR public key type %T", pub)
+	}
+
+	hosts := csrHosts(csr)
+	if opts.CommonName == "" {
+		opts.CommonName = csr.Subject.CommonName
+	}
+	// Legacy CSRs (e.g. from keytool) often carry the hostname only in the CN.
+	if len(hosts) == 0 && opts.CommonName != "" && !opts.Client && hostnameRegexp.MatchString(opts.CommonName) {
+		hosts = []string{opts.CommonName}
+	}
+	if len(hosts) == 0 && opts.CommonName == "" {
+		return fmt.Errorf("CSR requests no subject alternative names or common name")
+	}
+
+	certBytes, chain, err := issue(cfg, csr.PublicKey, hosts, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := saveCertificate(cfg, certBytes, nil, chain, hosts, opts); err != nil {
+		return err
+	}
+
+	log.Printf("Certificate created from CSR for %v\n", hosts)
+	return nil
+}
+
+// csrHosts lists the SANs requested in a CSR in the form accepted by addSANs.
+func csrHosts(csr *x509.CertificateRequest) []string {
+	var hosts []string
+	hosts = append(hosts, csr.DNSNames...)
+	for _, ip := range csr.IPAddresses {
+		hosts = append(hosts, ip.String())
+	}
+	hosts = append(hosts, csr.EmailAddresses...)
+	for _, uri := range csr.URIs {
+		hosts = append(hosts, uri.String())
+	}
+	return hosts
+}
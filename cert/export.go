@@ -0,0 +1,32 @@
+package cert
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/appremon/apprecert/config"
+)
+
+// ExportIssuer returns the CA that signs leaf certificates in PEM form, for
+// handing it to another issuer such as cert-manager: its certificate
+// followed by the root when it is an intermediate, its unencrypted key, and
+// the root certificate.
+func ExportIssuer(cfg *config.Config) (certPEM, keyPEM, rootPEM []byte, err error) {
+	issuer, key, root, err := cfg.LoadIssuer()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to encode private key: %w", err)
+	}
+
+	rootPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: issuer.Raw})
+	if issuer != root {
+		certPEM = append(certPEM, rootPEM...)
+	}
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})
+	return certPEM, keyPEM, rootPEM, nil
+}
@@ -3,28 +3,101 @@ package cert
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha1"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"fmt"
 	"math/big"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strings"
 
 	"github.com/appremon/apprecert/config"
+	"github.com/appremon/apprecert/pkcs8"
 )
 
-// GenerateKey generates a new private key (RSA or ECDSA).
-func GenerateKey(ecdsaKey bool, rootCA bool) (crypto.PrivateKey, error) {
-	if ecdsaKey {
-		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+// KeyType names a supported key algorithm.
+type KeyType string
+
+// Supported key types.
+const (
+	RSA2048   KeyType = "rsa2048"
+	RSA3072   KeyType = "rsa3072"
+	RSA4096   KeyType = "rsa4096"
+	ECDSAP256 KeyType = "ecdsa-p256"
+	ECDSAP384 KeyType = "ecdsa-p384"
+	ECDSAP521 KeyType = "ecdsa-p521"
+	Ed25519   KeyType = "ed25519"
+)
+
+// Default key types when neither the command line nor the CAROOT config names one.
+const (
+	DefaultCAKeyType   = RSA3072
+	DefaultLeafKeyType = RSA2048
+)
+
+// KeyTypes lists every supported key type.
+var KeyTypes = []KeyType{RSA2048, RSA3072, RSA4096, ECDSAP256, ECDSAP384, ECDSAP521, Ed25519}
+
+// ParseKeyType validates a key type name.
+func ParseKeyType(name string) (KeyType, error) {
+	for _, kt := range KeyTypes {
+		if string(kt) == strings.ToLower(name) {
+			return kt, nil
+		}
 	}
-	if rootCA {
+	return "", fmt.Errorf("unsupported key type %q (supported: %v)", name, KeyTypes)
+}
+
+// GenerateKey generates a new private key of the given type.
+func GenerateKey(keyType KeyType) (crypto.PrivateKey, error) {
+	switch keyType {
+	case RSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case RSA3072:
 		return rsa.GenerateKey(rand.Reader, 3072)
+	case RSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case ECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case ECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case ECDSAP521:
+		return ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case Ed25519:
+		_, privKey, err := ed25519.GenerateKey(rand.Reader)
+		return privKey, err
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", keyType)
+	}
+}
+
+// signatureAlgorithm picks the signature algorithm matching the signing key.
+func signatureAlgorithm(pub crypto.PublicKey) x509.SignatureAlgorithm {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return x509.SHA256WithRSA
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P384():
+			return x509.ECDSAWithSHA384
+		case elliptic.P521():
+			return x509.ECDSAWithSHA512
+		default:
+			return x509.ECDSAWithSHA256
+		}
+	case ed25519.PublicKey:
+		return x509.PureEd25519
+	default:
+		return x509.UnknownSignatureAlgorithm
 	}
-	return rsa.GenerateKey(rand.Reader, 2048)
 }
 
 // RandomSerialNumber generates a random serial number for a certificate.
@@ -37,38 +110,102 @@ func randomSerialNumber() *big.Int {
 	return serialNumber
 }
 
-// saveCertificate saves the generated certificate and private key to disk.
-func saveCertificate(cfg *config.Config, certBytes []byte, hosts []string) error {
-	certPath := filepath.Join(cfg.CAROOT, fmt.Sprintf("%s-cert.pem", hosts[0]))
-	keyPath := filepath.Join(cfg.CAROOT, fmt.Sprintf("%s-key.pem", hosts[0]))
-
-	// Save certificate
-	certFile, err := os.Create(certPath)
+// subjectKeyID computes the SHA-1 key identifier of a public key (RFC 5280, 4.2.1.2).
+func subjectKeyID(pub crypto.PublicKey) ([]byte, error) {
+	spkiBytes, err := x509.MarshalPKIXPublicKey(pub)
 	if err != nil {
-		return fmt.Errorf("failed to create certificate file: %w", err)
+		return nil, fmt.Errorf("failed to encode public key: %w", err)
 	}
-	defer certFile.Close()
-	if err := pem.Encode(certFile, &pem.Block{Type: "CERTIFICATE", Bytes: certBytes}); err != nil {
-		return fmt.Errorf("failed to write certificate: %w", err)
+	var spki struct {
+		Algorithm        pkix.AlgorithmIdentifier
+		SubjectPublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(spkiBytes, &spki); err != nil {
+		return nil, fmt.Errorf("failed to decode public key: %w", err)
 	}
+	skid := sha1.Sum(spki.SubjectPublicKey.Bytes)
+	return skid[:], nil
+}
 
-	// Save private key
-	privKey, err := GenerateKey(false, false) // Example: Generate a new key
-	if err != nil {
-		return fmt.Errorf("failed to generate private key: %w", err)
+// userAndHostname describes who created a CA, e.g. "alice@laptop".
+func userAndHostname() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
 	}
+	if host, err := os.Hostname(); err == nil {
+		name += "@" + host
+	}
+	return name
+}
+
+// savePrivateKey writes a private key in PKCS#8 PEM format, readable only by
+// the owner. A non-empty passphrase encrypts the key.
+func savePrivateKey(privKey crypto.PrivateKey, path string, passphrase []byte) error {
 	privKeyBytes, err := x509.MarshalPKCS8PrivateKey(privKey)
 	if err != nil {
 		return fmt.Errorf("failed to encode private key: %w", err)
 	}
-	keyFile, err := os.Create(keyPath)
-	if err != nil {
-		return fmt.Errorf("failed to create key file: %w", err)
+	block := &pem.Block{Type: "PRIVATE KEY", Bytes: privKeyBytes}
+	if len(passphrase) > 0 {
+		encrypted, err := pkcs8.Encrypt(privKeyBytes, passphrase)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt private key: %w", err)
+		}
+		block = &pem.Block{Type: pkcs8.PEMType, Bytes: encrypted}
+	}
+
+	// Tighten an existing file before overwriting it
+	if err := os.Chmod(path, 0600); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to restrict private key permissions: %w", err)
 	}
-	defer keyFile.Close()
-	if err := pem.Encode(keyFile, &pem.Block{Type: "PRIVATE KEY", Bytes: privKeyBytes}); err != nil {
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
 		return fmt.Errorf("failed to write private key: %w", err)
 	}
+	return nil
+}
+
+// saveCertificate saves the generated certificate and private key to disk.
+// A nil privKey (e.g. for a signed CSR) writes only the certificate. When the
+// chain includes an intermediate CA, a full-chain file is written as well.
+func saveCertificate(cfg *config.Config, certBytes []byte, privKey crypto.PrivateKey, chain []*x509.Certificate, hosts []string, opts Options) error {
+	name := fileBaseName(hosts, opts)
+	certPath := filepath.Join(cfg.CAROOT, fmt.Sprintf("%s-cert.pem", name))
+	keyPath := filepath.Join(cfg.CAROOT, fmt.Sprintf("%s-key.pem", name))
+
+	// Save certificate
+	if err := savePEM(certBytes, certPath); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+
+	// Save leaf + intermediates, without the root
+	if len(chain) > 1 {
+		fullChain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})
+		for _, c := range chain[:len(chain)-1] {
+			fullChain = append(fullChain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+		}
+		chainPath := filepath.Join(cfg.CAROOT, fmt.Sprintf("%s-fullchain.pem", name))
+		if err := os.WriteFile(chainPath, fullChain, 0644); err != nil {
+			return fmt.Errorf("failed to write full chain: %w", err)
+		}
+	}
+
+	if privKey == nil {
+		return nil
+	}
+
+	// Save private key
+	if err := savePrivateKey(privKey, keyPath, nil); err != nil {
+		return err
+	}
+
+	// Save PKCS#12 bundle
+	if opts.P12 {
+		p12Path := filepath.Join(cfg.CAROOT, fmt.Sprintf("%s.p12", name))
+		if err := saveP12(certBytes, privKey, chain, defaultP12Password, p12Path); err != nil {
+			return err
+		}
+	}
 
 	return nil
-}
\ No newline at end of file
+}
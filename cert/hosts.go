@@ -0,0 +1,47 @@
+package cert
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var hostnameRegexp = regexp.MustCompile(`(?i)^(\*\.)?[0-9a-z_-]+(\.[0-9a-z_-]+)*\.?$`)
+
+// addSANs sorts each host argument into the matching Subject Alternative Name
+// field: IP address, email address, URI or DNS name.
+func addSANs(tpl *x509.Certificate, hosts []string) error {
+	for _, h := range hosts {
+		if ip := net.ParseIP(strings.Trim(h, "[]")); ip != nil {
+			tpl.IPAddresses = append(tpl.IPAddresses, ip)
+		} else if email, err := mail.ParseAddress(h); err == nil && email.Address == h {
+			tpl.EmailAddresses = append(tpl.EmailAddresses, h)
+		} else if uriName, err := url.Parse(h); err == nil && uriName.Scheme != "" && uriName.Host != "" {
+			tpl.URIs = append(tpl.URIs, uriName)
+		} else if hostnameRegexp.MatchString(h) {
+			tpl.DNSNames = append(tpl.DNSNames, strings.ToLower(h))
+		} else {
+			return fmt.Errorf("%q is not a valid hostname, IP, email address or URI", h)
+		}
+	}
+	return nil
+}
+
+// fileBaseName derives a safe file name prefix from the first host, or the
+// common name when there are no hosts. Client certificates get a "-client" suffix.
+func fileBaseName(hosts []string, opts Options) string {
+	name := opts.CommonName
+	if len(hosts) > 0 {
+		name = hosts[0]
+	}
+	r := strings.NewReplacer("*", "_wildcard", ":", "_", "/", "_", "\\", "_", "[", "", "]", "", " ", "_")
+	name = r.Replace(name)
+	if opts.Client {
+		name += "-client"
+	}
+	return name
+}
@@ -0,0 +1,45 @@
+package cert
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/appremon/apprecert/config"
+	"github.com/appremon/apprecert/utils"
+)
+
+// ChangePassphrase re-encrypts a CA key in CAROOT (config.RootKeyFile or
+// config.IntermediateKeyFile) with newPassphrase, or stores it unencrypted
+// when newPassphrase is empty. The current passphrase is read as usual.
+func ChangePassphrase(cfg *config.Config, keyFile string, newPassphrase []byte) error {
+	keyPath := filepath.Join(cfg.CAROOT, keyFile)
+	privKey, err := cfg.LoadPrivateKey(keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", keyFile, err)
+	}
+
+	if err := savePrivateKey(privKey, keyPath, newPassphrase); err != nil {
+		return err
+	}
+
+	// rootCA.p12 of older versions also carries the root key; rewrite it
+	// as a trust store so the key is only in the file just protected
+	p12Path := filepath.Join(cfg.CAROOT, "rootCA.p12")
+	if keyFile == config.RootKeyFile && utils.PathExists(p12Path) {
+		rootCert, err := cfg.LoadRootCert()
+		if err != nil {
+			return err
+		}
+		if err := saveTrustStoreP12(rootCert, p12Path); err != nil {
+			return fmt.Errorf("failed to update rootCA.p12: %w", err)
+		}
+	}
+
+	if len(newPassphrase) == 0 {
+		log.Printf("Removed the passphrase from %s\n", keyFile)
+	} else {
+		log.Printf("Changed the passphrase of %s\n", keyFile)
+	}
+	return nil
+}
@@ -13,8 +13,13 @@ import (
 	"software.sslmate.com/src/go-pkcs12"
 )
 
-// GenerateMultipleFormats saves certificates in .pem, .crt, and .p12 formats.
-func GenerateMultipleFormats(cfg *config.Config, certBytes []byte, privKey crypto.PrivateKey) error {
+// defaultP12Password protects the PKCS#12 files apprecert writes.
+const defaultP12Password = "changeit"
+
+// GenerateMultipleFormats saves the root certificate in .pem, .crt, and .p12
+// formats. The .p12 is a trust store holding only the certificate, so the
+// root key stays in rootCA-key.pem alone.
+func GenerateMultipleFormats(cfg *config.Config, certBytes []byte) error {
 	// Save PEM format
 	pemPath := filepath.Join(cfg.CAROOT, "rootCA.pem")
 	if err := savePEM(certBytes, pemPath); err != nil {
@@ -28,12 +33,21 @@ func GenerateMultipleFormats(cfg *config.Config, certBytes []byte, privKey crypt
 	}
 
 	// Save P12 format
-	p12Path := filepath.Join(cfg.CAROOT, "rootCA.p12")
-	if err := saveP12(certBytes, privKey, p12Path); err != nil {
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
 		return err
 	}
+	return saveTrustStoreP12(cert, filepath.Join(cfg.CAROOT, "rootCA.p12"))
+}
 
-	return nil
+// saveTrustStoreP12 writes cert as a PKCS#12 trust store without a private
+// key, protected by defaultP12Password.
+func saveTrustStoreP12(cert *x509.Certificate, path string) error {
+	p12Data, err := pkcs12.Modern.WithRand(rand.Reader).EncodeTrustStore([]*x509.Certificate{cert}, defaultP12Password)
+	if err != nil {
+		return fmt.Errorf("failed to generate PKCS#12: %w", err)
+	}
+	return os.WriteFile(path, p12Data, 0644)
 }
 
 // savePEM saves the certificate in PEM format.
@@ -42,15 +56,19 @@ func savePEM(certBytes []byte, path string) error {
 	return os.WriteFile(path, certPEM, 0644)
 }
 
-// saveP12 saves the certificate and private key in P12 format.
-func saveP12(certBytes []byte, privKey crypto.PrivateKey, path string) error {
+// saveP12 saves the certificate, private key and optional CA chain in P12
+// format, encrypted with AES-256 and PBKDF2.
+func saveP12(certBytes []byte, privKey crypto.PrivateKey, caCerts []*x509.Certificate, password, path string) error {
 	cert, err := x509.ParseCertificate(certBytes)
 	if err != nil {
 		return err
 	}
-	p12Data, err := pkcs12.Encode(rand.Reader, privKey, cert, nil, "changeit")
+	p12Data, err := pkcs12.Modern.WithRand(rand.Reader).Encode(privKey, cert, caCerts, password)
 	if err != nil {
 		return fmt.Errorf("failed to generate PKCS#12: %w", err)
 	}
-	return os.WriteFile(path, p12Data, 0644)
+	if err := os.Chmod(path, 0600); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.WriteFile(path, p12Data, 0600)
 }
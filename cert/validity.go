@@ -0,0 +1,65 @@
+package cert
+
+import (
+	"crypto/x509"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Default and maximum certificate lifetimes, in days.
+const (
+	DefaultCADays           = 3650
+	DefaultIntermediateDays = 1825
+	DefaultLeafDays         = 397
+	MaxLeafDays             = 398 // Apple and Chrome limit for TLS server certificates
+)
+
+// Validity controls a certificate's lifetime.
+type Validity struct {
+	Days      int           // lifetime in days, counted from the backdated NotBefore
+	NotBefore time.Time     // explicit start, now if zero
+	NotAfter  time.Time     // explicit end, overrides Days
+	Backdate  time.Duration // moves the start back to tolerate clock skew, within Days
+}
+
+// window resolves the validity into concrete bounds, using defaultDays when
+// neither Days nor NotAfter is set.
+func (v Validity) window(defaultDays int) (time.Time, time.Time, error) {
+	notBefore := v.NotBefore
+	if notBefore.IsZero() {
+		notBefore = time.Now()
+	}
+	// Backdate before counting Days, so the lifetime stays within it
+	notBefore = notBefore.Add(-v.Backdate)
+
+	notAfter := v.NotAfter
+	if notAfter.IsZero() {
+		days := v.Days
+		if days == 0 {
+			days = defaultDays
+		}
+		if days < 0 {
+			return time.Time{}, time.Time{}, fmt.Errorf("validity must be a positive number of days")
+		}
+		notAfter = notBefore.AddDate(0, 0, days)
+	}
+
+	if !notAfter.After(notBefore) {
+		return time.Time{}, time.Time{}, fmt.Errorf("not-after %s is not after not-before %s",
+			notAfter.Format(time.RFC3339), notBefore.Format(time.RFC3339))
+	}
+	return notBefore, notAfter, nil
+}
+
+// clampToIssuer keeps a certificate's validity within its issuer's.
+func clampToIssuer(notBefore, notAfter time.Time, issuer *x509.Certificate) (time.Time, time.Time) {
+	if notBefore.Before(issuer.NotBefore) {
+		notBefore = issuer.NotBefore
+	}
+	if notAfter.After(issuer.NotAfter) {
+		log.Printf("Warning: limiting validity to the issuing CA's expiry (%s)\n", issuer.NotAfter.Format(time.RFC3339))
+		notAfter = issuer.NotAfter
+	}
+	return notBefore, notAfter
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/appremon/apprecert/cert"
+	"github.com/appremon/apprecert/config"
+)
+
+// runCA handles the "apprecert ca <command>" subcommands.
+func runCA(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: apprecert ca init|intermediate|passphrase [flags]")
+	}
+
+	switch args[0] {
+	case "init":
+		fs := flag.NewFlagSet("ca init", flag.ExitOnError)
+		forceFlag := fs.Bool("force", false, "Replace an existing CA")
+		keyTypeFlag := fs.String("key-type", string(cert.DefaultCAKeyType), "CA key algorithm")
+		leafKeyTypeFlag := fs.String("leaf-key-type", "", "Default leaf key algorithm (default: "+string(cert.DefaultLeafKeyType)+")")
+		validity := validityFlags(fs)
+		localOnlyFlag := fs.Bool("local-only", false, "Only allow local names and private IP ranges")
+		permitDNSFlag := fs.String("permit-dns", "", "Comma-separated DNS suffixes the CA may issue for, e.g. .test,.local")
+		excludeDNSFlag := fs.String("exclude-dns", "", "Comma-separated DNS suffixes the CA may not issue for")
+		permitIPFlag := fs.String("permit-ip", "", "Comma-separated IP ranges the CA may issue for, e.g. 127.0.0.0/8")
+		excludeIPFlag := fs.String("exclude-ip", "", "Comma-separated IP ranges the CA may not issue for")
+		noPassFlag := fs.Bool("no-passphrase", false, "Store the CA key unencrypted")
+		passFileFlag := fs.String("passphrase-file", "", "Read the CA key passphrase from a file")
+		fs.Parse(args[1:])
+
+		keyType, err := cert.ParseKeyType(*keyTypeFlag)
+		if err != nil {
+			log.Fatalf("Invalid -key-type: %v", err)
+		}
+		opts := cert.CAOptions{Force: *forceFlag, KeyType: keyType, NoPassphrase: *noPassFlag}
+		if *leafKeyTypeFlag != "" {
+			if opts.LeafKeyType, err = cert.ParseKeyType(*leafKeyTypeFlag); err != nil {
+				log.Fatalf("Invalid -leaf-key-type: %v", err)
+			}
+		}
+		if opts.Validity, err = validity(); err != nil {
+			log.Fatalf("%v", err)
+		}
+
+		nc := &config.NameConstraints{}
+		if *localOnlyFlag {
+			nc = cert.LocalNameConstraints()
+		}
+		nc.PermittedDNS = append(nc.PermittedDNS, splitList(*permitDNSFlag)...)
+		nc.ExcludedDNS = append(nc.ExcludedDNS, splitList(*excludeDNSFlag)...)
+		nc.PermittedIPs = append(nc.PermittedIPs, splitList(*permitIPFlag)...)
+		nc.ExcludedIPs = append(nc.ExcludedIPs, splitList(*excludeIPFlag)...)
+		opts.NameConstraints = nc
+
+		cfg := config.Load()
+		cfg.PassphraseFile = *passFileFlag
+		if err := cert.CreateCA(cfg, opts); err != nil {
+			log.Fatalf("Failed to create CA: %v", err)
+		}
+		log.Println("CA created successfully!")
+	case "intermediate":
+		fs := flag.NewFlagSet("ca intermediate", flag.ExitOnError)
+		forceFlag := fs.Bool("force", false, "Replace an existing intermediate CA")
+		keyTypeFlag := fs.String("key-type", "", "Intermediate CA key algorithm (default: the root's algorithm)")
+		validity := validityFlags(fs)
+		noPassFlag := fs.Bool("no-passphrase", false, "Store the intermediate CA key unencrypted")
+		passFileFlag := fs.String("passphrase-file", "", "Read the CA key passphrase from a file")
+		fs.Parse(args[1:])
+
+		opts := cert.CAOptions{Force: *forceFlag, NoPassphrase: *noPassFlag}
+		var err error
+		if opts.Validity, err = validity(); err != nil {
+			log.Fatalf("%v", err)
+		}
+		if *keyTypeFlag != "" {
+			keyType, err := cert.ParseKeyType(*keyTypeFlag)
+			if err != nil {
+				log.Fatalf("Invalid -key-type: %v", err)
+			}
+			opts.KeyType = keyType
+		}
+
+		cfg := config.Load()
+		cfg.PassphraseFile = *passFileFlag
+		if err := cert.CreateIntermediate(cfg, opts); err != nil {
+			log.Fatalf("Failed to create intermediate CA: %v", err)
+		}
+		log.Println("Intermediate CA created successfully!")
+	case "passphrase":
+		fs := flag.NewFlagSet("ca passphrase", flag.ExitOnError)
+		removeFlag := fs.Bool("remove", false, "Store the key unencrypted")
+		intermediateFlag := fs.Bool("intermediate", false, "Change the intermediate CA key instead of the root key")
+		passFileFlag := fs.String("passphrase-file", "", "Read the current passphrase from a file")
+		newPassFileFlag := fs.String("new-passphrase-file", "", "Read the new passphrase from a file")
+		fs.Parse(args[1:])
+
+		cfg := config.Load()
+		cfg.PassphraseFile = *passFileFlag
+		keyFile := config.RootKeyFile
+		if *intermediateFlag {
+			keyFile = config.IntermediateKeyFile
+		}
+
+		var newPass []byte
+		if !*removeFlag {
+			var err error
+			if *newPassFileFlag != "" {
+				newPass, err = config.ReadPassphraseFile(*newPassFileFlag)
+			} else {
+				newPass, err = config.PromptNewPassphrase()
+			}
+			if err != nil {
+				log.Fatalf("Failed to read new passphrase: %v", err)
+			}
+		}
+		if err := cert.ChangePassphrase(cfg, keyFile, newPass); err != nil {
+			log.Fatalf("Failed to change passphrase: %v", err)
+		}
+	default:
+		log.Fatalf("Unknown ca command %q. Use -help for usage information.", args[0])
+	}
+}
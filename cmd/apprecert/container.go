@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/appremon/apprecert/config"
+	"github.com/appremon/apprecert/container"
+)
+
+// runContainer handles the "apprecert container <command>" subcommands.
+func runContainer(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: apprecert container snippet|patch-oci [flags]")
+	}
+
+	switch args[0] {
+	case "snippet":
+		fs := flag.NewFlagSet("container snippet", flag.ExitOnError)
+		distroFlag := fs.String("distro", "debian", fmt.Sprintf("Base image family, one of %v", container.Distros()))
+		dirFlag := fs.String("dir", ".", "Build context to copy the root CA into")
+		fs.Parse(args[1:])
+
+		snippet, err := container.Snippet(*distroFlag)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		cfg := config.Load()
+		caPEM, err := os.ReadFile(filepath.Join(cfg.CAROOT, config.RootCertFile))
+		if err != nil {
+			log.Fatalf("Failed to read certificate: %v", err)
+		}
+		caPath := filepath.Join(*dirFlag, container.CAFile)
+		if err := os.WriteFile(caPath, caPEM, 0644); err != nil {
+			log.Fatalf("Failed to write %s: %v", caPath, err)
+		}
+		if strings.EqualFold(*distroFlag, "distroless") {
+			log.Printf("Wrote %s; add the %s stage before the distroless stage of the Dockerfile and copy the bundle from it:\n", caPath, container.HelperStage)
+		} else {
+			log.Printf("Wrote %s; add this to the Dockerfile:\n", caPath)
+		}
+		fmt.Print(snippet)
+	case "patch-oci":
+		fs := flag.NewFlagSet("container patch-oci", flag.ExitOnError)
+		refFlag := fs.String("ref", "", "Only patch the image with this ref.name annotation, e.g. a tag")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			log.Fatalf("Usage: apprecert container patch-oci [-ref name] <layout dir>")
+		}
+
+		cfg := config.Load()
+		caPEM, err := os.ReadFile(filepath.Join(cfg.CAROOT, config.RootCertFile))
+		if err != nil {
+			log.Fatalf("Failed to read certificate: %v", err)
+		}
+		n, err := container.PatchLayout(fs.Arg(0), *refFlag, caPEM)
+		if err != nil {
+			log.Fatalf("Failed to patch image: %v", err)
+		}
+		if n == 0 {
+			log.Println("The images already trust the CA; nothing changed.")
+			return
+		}
+		log.Printf("Added the CA to %d image(s).\n", n)
+	default:
+		log.Fatalf("Unknown container command %q. Use -help for usage information.", args[0])
+	}
+}
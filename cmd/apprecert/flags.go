@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/appremon/apprecert/cert"
+	"github.com/appremon/apprecert/config"
+)
+
+// validityFlags registers the certificate lifetime flags on fs and returns a
+// function that parses them once fs has been parsed.
+func validityFlags(fs *flag.FlagSet) func() (cert.Validity, error) {
+	days := fs.Int("days", 0, "Validity in days")
+	notBefore := fs.String("not-before", "", "Start of validity (YYYY-MM-DD or RFC 3339)")
+	notAfter := fs.String("not-after", "", "End of validity (YYYY-MM-DD or RFC 3339), overrides -days")
+	backdate := fs.Duration("backdate", 0, "Move the start of validity back to tolerate clock skew, e.g. 1h (counts towards -days)")
+
+	return func() (cert.Validity, error) {
+		v := cert.Validity{Days: *days, Backdate: *backdate}
+		var err error
+		if v.NotBefore, err = parseTime(*notBefore); err != nil {
+			return v, fmt.Errorf("invalid -not-before: %w", err)
+		}
+		if v.NotAfter, err = parseTime(*notAfter); err != nil {
+			return v, fmt.Errorf("invalid -not-after: %w", err)
+		}
+		return v, nil
+	}
+}
+
+// kubeFlags registers the cluster selection flags on fs, describing
+// -kube-namespace with namespaceUsage, and returns a function that copies
+// them into cfg once fs has been parsed.
+func kubeFlags(fs *flag.FlagSet, namespaceUsage string) func(cfg *config.Config) {
+	kubeconfig := fs.String("kubeconfig", "", "Kubeconfig file (default: KUBECONFIG or ~/.kube/config)")
+	context := fs.String("kube-context", "", "Kubeconfig context (default: the current context)")
+	namespace := fs.String("kube-namespace", "", namespaceUsage)
+
+	return func(cfg *config.Config) {
+		cfg.Kubeconfig = *kubeconfig
+		cfg.KubeContext = *context
+		cfg.KubeNamespace = *namespace
+	}
+}
+
+// storeNamespaceUsage describes -kube-namespace for the kubernetes store.
+const storeNamespaceUsage = "Namespace of the CA bundle ConfigMap (default: kube-system)"
+
+// parseTime accepts a date or an RFC 3339 timestamp; empty means unset.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// passwordsFlag collects repeated key=password flags into a map.
+type passwordsFlag map[string]string
+
+func (f passwordsFlag) String() string { return "" }
+
+func (f passwordsFlag) Set(value string) error {
+	key, password, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected <jdk-home or cacerts>=<password>")
+	}
+	f[key] = password
+	return nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// isFlagSet reports whether the named flag was given on the command line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/appremon/apprecert/cert"
+	"github.com/appremon/apprecert/config"
+	"github.com/appremon/apprecert/kube"
+)
+
+// certManagerNamespace is cert-manager's default cluster resource namespace.
+const certManagerNamespace = "cert-manager"
+
+// runKube handles the "apprecert kube <command>" subcommands.
+func runKube(args []string) {
+	if len(args) == 0 {
+		log.Fatalf("Usage: apprecert kube export [flags]")
+	}
+
+	switch args[0] {
+	case "export":
+		fs := flag.NewFlagSet("kube export", flag.ExitOnError)
+		applyFlag := fs.Bool("apply", false, "Apply the objects to the cluster instead of printing them")
+		deleteFlag := fs.Bool("delete", false, "Delete the objects from the cluster")
+		nameFlag := fs.String("name", "apprecert-ca", "Name of the Secret, ClusterIssuer and Bundle")
+		passFileFlag := fs.String("passphrase-file", "", "Read the CA key passphrase from a file")
+		kubeOpts := kubeFlags(fs, "cert-manager's cluster resource namespace, where the Secret goes (default: "+certManagerNamespace+")")
+		fs.Parse(args[1:])
+
+		cfg := config.Load()
+		cfg.PassphraseFile = *passFileFlag
+		kubeOpts(cfg)
+		if cfg.KubeNamespace == "" {
+			cfg.KubeNamespace = certManagerNamespace
+		}
+
+		export := kube.CertManager{Name: *nameFlag, Namespace: cfg.KubeNamespace}
+		if !*deleteFlag {
+			var err error
+			if export.CertPEM, export.KeyPEM, export.RootPEM, err = cert.ExportIssuer(cfg); err != nil {
+				log.Fatalf("Failed to load CA: %v", err)
+			}
+			if !cfg.HasIntermediate() {
+				log.Println("Warning: exporting the root CA key; create an intermediate CA with \"apprecert ca intermediate\" to keep it out of the cluster.")
+			}
+		}
+		objs := export.Objects()
+
+		if !*applyFlag && !*deleteFlag {
+			if err := kube.WriteYAML(os.Stdout, objs); err != nil {
+				log.Fatalf("Failed to write manifests: %v", err)
+			}
+			return
+		}
+
+		client, _, err := kube.NewDynamicClient(kube.Options{Kubeconfig: cfg.Kubeconfig, Context: cfg.KubeContext, Namespace: cfg.KubeNamespace})
+		if err != nil {
+			log.Fatalf("Failed to connect to cluster: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), kube.Timeout)
+		defer cancel()
+		if *deleteFlag {
+			// Delete in reverse, so the issuer never points at a missing Secret
+			for i := len(objs) - 1; i >= 0; i-- {
+				if err := kube.DeleteObject(ctx, client, objs[i]); err != nil {
+					log.Fatalf("Failed to delete objects: %v", err)
+				}
+			}
+			log.Println("cert-manager objects deleted successfully!")
+			return
+		}
+		for _, obj := range objs {
+			if err := kube.ApplyObject(ctx, client, obj); err != nil {
+				log.Fatalf("Failed to apply objects: %v", err)
+			}
+		}
+		log.Println("cert-manager objects applied successfully!")
+	default:
+		log.Fatalf("Unknown kube command %q. Use -help for usage information.", args[0])
+	}
+}
+
+// issueSecret issues a certificate for hosts as the kubernetes.io/tls Secret
+// ref, given as [namespace/]name, and prints it as YAML or applies it to the
+// cluster selected in cfg. Without a namespace, the printed Secret has none
+// and the applied one goes into the context's namespace.
+func issueSecret(cfg *config.Config, hosts []string, opts cert.Options, ref string, apply bool) error {
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok {
+		namespace, name = "", ref
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid Secret %q, expected [namespace/]name", ref)
+	}
+
+	var client dynamic.Interface
+	if apply {
+		// Connect first, so no certificate is issued for an unreachable cluster
+		var err error
+		client, namespace, err = kube.NewDynamicClient(kube.Options{Kubeconfig: cfg.Kubeconfig, Context: cfg.KubeContext, Namespace: namespace})
+		if err != nil {
+			return err
+		}
+	}
+
+	issued, err := cert.Issue(cfg, hosts, opts)
+	if err != nil {
+		return err
+	}
+	secret := kube.TLSSecret(namespace, name, issued.CertPEM, issued.KeyPEM, issued.RootPEM)
+	if !apply {
+		return kube.WriteYAML(os.Stdout, []*unstructured.Unstructured{secret})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kube.Timeout)
+	defer cancel()
+	if err := kube.ApplyObject(ctx, client, secret); err != nil {
+		return err
+	}
+	log.Printf("Certificate stored in Secret %s/%s\n", namespace, name)
+	return nil
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/appremon/apprecert/cert"
 	"github.com/appremon/apprecert/config"
@@ -10,10 +13,51 @@ import (
 )
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "ca":
+			runCA(os.Args[2:])
+			return
+		case "status":
+			runStatus(os.Args[2:])
+			return
+		case "rollback":
+			runRollback(os.Args[2:])
+			return
+		case "kube":
+			runKube(os.Args[2:])
+			return
+		case "container":
+			runContainer(os.Args[2:])
+			return
+		}
+	}
+
 	// Define flags
 	installFlag := flag.Bool("install", false, "Install the CA")
 	uninstallFlag := flag.Bool("uninstall", false, "Uninstall the CA")
 	helpFlag := flag.Bool("help", false, "Show usage information")
+	clientFlag := flag.Bool("client", false, "Issue a client (mTLS) certificate")
+	serverFlag := flag.Bool("server", false, "With -client, issue a combined server and client certificate")
+	cnFlag := flag.String("cn", "", "Subject common name, e.g. a client identity")
+	p12Flag := flag.Bool("p12", false, "Also write a PKCS#12 bundle (password \"changeit\")")
+	keyTypeFlag := flag.String("key-type", "", "Leaf key algorithm (default: the CA's algorithm)")
+	csrFlag := flag.String("csr", "", "Sign the given certificate signing request instead of generating a key")
+	strictFlag := flag.Bool("strict-lifetime", false, fmt.Sprintf("Refuse server certificates valid for more than %d days", cert.MaxLeafDays))
+	validity := validityFlags(flag.CommandLine)
+	passFileFlag := flag.String("passphrase-file", "", "Read the CA key passphrase from a file")
+	storesFlag := flag.String("stores", "", "Comma-separated trust stores to install into or uninstall from (default: all detected)")
+	skipFlag := flag.String("skip", "", "Comma-separated trust stores to leave alone")
+	dryRunFlag := flag.Bool("dry-run", false, "With -install or -uninstall, print the changes instead of making them")
+	gitURLFlag := flag.String("git-url", "", "Comma-separated URLs Git should trust the CA for, instead of all hosts")
+	registriesFlag := flag.String("registries", "", "Comma-separated registries (host:port) Docker, Podman and containerd should trust the CA for")
+	pipConfFlag := flag.Bool("python-pip-conf", false, "Point pip at a CA bundle through pip.conf instead of editing certifi bundles")
+	javaPasswords := passwordsFlag{}
+	flag.Var(javaPasswords, "java-store-password", "Store password of a JDK's cacerts, as <jdk-home or cacerts>=<password> (repeatable; empty to forget)")
+	kubeSecretFlag := flag.String("kube-secret", "", "Write the certificate as a kubernetes.io/tls Secret [namespace/]name to stdout instead of CAROOT")
+	kubeApplyFlag := flag.Bool("kube-apply", false, "With -kube-secret, apply the Secret to the cluster instead of printing it")
+	kube := kubeFlags(flag.CommandLine, storeNamespaceUsage)
 
 	flag.Parse()
 
@@ -24,26 +68,127 @@ func main() {
 
 	// Initialize configuration
 	cfg := config.Load()
+	cfg.PassphraseFile = *passFileFlag
+	kube(cfg)
+	for key, password := range javaPasswords {
+		if cfg.JavaStorePasswords == nil {
+			cfg.JavaStorePasswords = make(map[string]string)
+		}
+		if password == "" {
+			delete(cfg.JavaStorePasswords, key)
+		} else {
+			cfg.JavaStorePasswords[key] = password
+		}
+	}
+
+	sel := truststore.Selection{Only: splitList(*storesFlag), Skip: splitList(*skipFlag)}
+	if *dryRunFlag {
+		truststore.SetRunner(truststore.NewRecorder(log.Writer()))
+	}
 
 	if *installFlag {
-		if err := truststore.Install(cfg); err != nil {
+		save := false
+		if isFlagSet("git-url") {
+			cfg.GitURLs, save = splitList(*gitURLFlag), true
+		}
+		if isFlagSet("registries") {
+			cfg.ContainerRegistries, save = splitList(*registriesFlag), true
+		}
+		if isFlagSet("python-pip-conf") {
+			cfg.PythonPipConf, save = *pipConfFlag, true
+		}
+		if len(javaPasswords) > 0 {
+			save = true
+		}
+		if save && !*dryRunFlag {
+			if err := cfg.Save(); err != nil {
+				log.Fatalf("Failed to save configuration: %v", err)
+			}
+		}
+		results, err := truststore.Install(cfg, sel)
+		reportResults("installed", results)
+		if err != nil {
 			log.Fatalf("Failed to install CA: %v", err)
 		}
+		if err := results.Err(); err != nil {
+			log.Fatalf("Failed to install CA, all changes were rolled back: %v", err)
+		}
+		if *dryRunFlag {
+			log.Println("Dry run: no changes were made.")
+			return
+		}
 		log.Println("CA installed successfully!")
 		return
 	}
 
 	if *uninstallFlag {
-		if err := truststore.Uninstall(cfg); err != nil {
+		results, err := truststore.Uninstall(cfg, sel)
+		reportResults("uninstalled", results)
+		if err != nil {
+			log.Fatalf("Failed to uninstall CA: %v", err)
+		}
+		if err := results.Err(); err != nil {
 			log.Fatalf("Failed to uninstall CA: %v", err)
 		}
+		if *dryRunFlag {
+			log.Println("Dry run: no changes were made.")
+			return
+		}
 		log.Println("CA uninstalled successfully!")
 		return
 	}
 
+	opts := cert.Options{
+		Server:         *serverFlag,
+		Client:         *clientFlag,
+		CommonName:     *cnFlag,
+		P12:            *p12Flag,
+		StrictLifetime: *strictFlag,
+	}
+	var err error
+	if opts.Validity, err = validity(); err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	if *kubeApplyFlag && *kubeSecretFlag == "" {
+		log.Fatalf("-kube-apply requires -kube-secret")
+	}
+
+	// Sign an externally generated CSR
+	if *csrFlag != "" {
+		if *kubeSecretFlag != "" {
+			log.Fatalf("-kube-secret needs the private key; it cannot be used with -csr")
+		}
+		if len(flag.Args()) > 0 || *keyTypeFlag != "" {
+			log.Fatalf("-csr takes the names and key from the CSR; do not pass hosts or -key-type")
+		}
+		csr, err := cert.LoadCSR(*csrFlag)
+		if err != nil {
+			log.Fatalf("Failed to load CSR: %v", err)
+		}
+		if err := cert.SignCSR(cfg, csr, opts); err != nil {
+			log.Fatalf("Failed to sign CSR: %v", err)
+		}
+		log.Println("Certificate generated successfully!")
+		return
+	}
+
 	// Default action: generate certificate
-	if len(flag.Args()) > 0 {
-		if err := cert.Generate(cfg, flag.Args()); err != nil {
+	if len(flag.Args()) > 0 || *cnFlag != "" {
+		if *keyTypeFlag != "" {
+			keyType, err := cert.ParseKeyType(*keyTypeFlag)
+			if err != nil {
+				log.Fatalf("Invalid -key-type: %v", err)
+			}
+			opts.KeyType = keyType
+		}
+		if *kubeSecretFlag != "" {
+			if err := issueSecret(cfg, flag.Args(), opts, *kubeSecretFlag, *kubeApplyFlag); err != nil {
+				log.Fatalf("Failed to issue certificate as Secret: %v", err)
+			}
+			return
+		}
+		if err := cert.Generate(cfg, flag.Args(), opts); err != nil {
 			log.Fatalf("Failed to generate certificate: %v", err)
 		}
 		log.Println("Certificate generated successfully!")
@@ -54,7 +199,40 @@ func main() {
 
 func printHelp() {
 	log.Println("Usage of apprecert:")
-	log.Println("  -install: Install the local CA.")
+	log.Println("  ca init [-force] [-key-type type] [-leaf-key-type type] [-days n]: Create a new local CA in CAROOT.")
+	log.Println("      [-local-only] [-permit-dns list] [-exclude-dns list] [-permit-ip list] [-exclude-ip list]: Name constraints.")
+	log.Println("      [-no-passphrase] [-passphrase-file file]: Store the CA key unencrypted or read its passphrase from a file.")
+	log.Println("  ca intermediate [-force] [-key-type type] [-days n] [-no-passphrase]: Create an intermediate CA that issues leaves.")
+	log.Println("  ca passphrase [-remove] [-intermediate] [-new-passphrase-file file]: Change or remove a CA key passphrase.")
+	log.Println("  status [-json] [-stores list] [-skip list] [-kubeconfig file] [-kube-context name] [-kube-namespace ns]: Show where the local CA is trusted.")
+	log.Println("  rollback [-dry-run]: Revert the changes of an interrupted -install.")
+	log.Println("  kube export [-apply|-delete] [-name name] [-kube-namespace ns]: Print or apply a CA Secret, cert-manager ClusterIssuer and trust-manager Bundle.")
+	log.Println("  container snippet [-distro name] [-dir dir]: Copy the root CA into a build context and print the Dockerfile lines trusting it.")
+	log.Println("  container patch-oci [-ref name] <dir>: Add the root CA to the CA bundle of the images in an OCI image layout.")
+	log.Println("  -install: Install the local CA; if any trust store fails, all changes are rolled back.")
 	log.Println("  -uninstall: Uninstall the local CA.")
+	log.Println("  -stores <list>: Only install into or uninstall from these trust stores.")
+	log.Println("  -skip <list>: Leave these trust stores alone.")
+	log.Println("  -dry-run: With -install or -uninstall, print every command and file change without making it.")
+	log.Printf("      Trust stores: %s\n", strings.Join(truststore.StoreNames(), ", "))
+	log.Println("  -kubeconfig <file>, -kube-context <name>, -kube-namespace <ns>: Cluster and namespace of the kubernetes store.")
+	log.Println("  -git-url <list>: With -install, make Git trust the CA only for these URLs; an empty list means all hosts.")
+	log.Println("  -registries <list>: With -install, make Docker, Podman and containerd trust the CA for these registries (host:port).")
+	log.Println("  -python-pip-conf: With -install, set pip's cert option in pip.conf instead of editing certifi bundles; =false switches back.")
+	log.Println("  -java-store-password <jdk>=<password>: Store password of a JDK's cacerts, by JDK home or cacerts path; saved with -install.")
+	log.Println("  -client: Issue a client (mTLS) certificate.")
+	log.Println("  -server: With -client, issue a combined server and client certificate.")
+	log.Println("  -cn <name>: Set the subject common name.")
+	log.Println("  -p12: Also write a PKCS#12 bundle.")
+	log.Printf("  -key-type <type>: Leaf key algorithm, one of %v.\n", cert.KeyTypes)
+	log.Printf("  -days <n>: Certificate validity in days (default %d).\n", cert.DefaultLeafDays)
+	log.Println("  -not-before, -not-after <date>: Explicit validity bounds (YYYY-MM-DD or RFC 3339).")
+	log.Println("  -backdate <duration>: Start validity earlier to tolerate clock skew, e.g. 1h.")
+	log.Printf("  -strict-lifetime: Refuse server certificates valid for more than %d days.\n", cert.MaxLeafDays)
+	log.Printf("  -passphrase-file <file>: Read the CA key passphrase from a file (or set %s).\n", config.PassphraseEnv)
+	log.Println("  -csr <file>: Sign a certificate signing request; only the certificate is written.")
+	log.Println("  -kube-secret <[namespace/]name>: Print the certificate as a kubernetes.io/tls Secret instead of writing files.")
+	log.Println("  -kube-apply: With -kube-secret, create or update the Secret in the cluster of -kubeconfig and -kube-context.")
 	log.Println("  -help: Display usage information.")
+	log.Println("  <host>...: Issue a certificate for DNS names, IPs, emails or URIs.")
 }
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/appremon/apprecert/config"
+	"github.com/appremon/apprecert/truststore"
+)
+
+// runStatus handles "apprecert status": it reports where the root CA is
+// trusted and exits with status 1 if it is absent or stale anywhere.
+func runStatus(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	jsonFlag := fs.Bool("json", false, "Print the report as JSON")
+	storesFlag := fs.String("stores", "", "Comma-separated trust stores to inspect (default: all)")
+	skipFlag := fs.String("skip", "", "Comma-separated trust stores not to inspect")
+	kube := kubeFlags(fs, storeNamespaceUsage)
+	fs.Parse(args)
+
+	cfg := config.Load()
+	kube(cfg)
+	sel := truststore.Selection{Only: splitList(*storesFlag), Skip: splitList(*skipFlag)}
+	report, err := truststore.Check(cfg, sel)
+	if err != nil {
+		log.Fatalf("Failed to check trust stores: %v", err)
+	}
+
+	if *jsonFlag {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+	} else {
+		printStatus(report)
+	}
+
+	for _, st := range report.Statuses {
+		if st.State == truststore.StateAbsent || st.State == truststore.StateStale {
+			os.Exit(1)
+		}
+	}
+}
+
+// printStatus writes the report as a table.
+func printStatus(report *truststore.Report) {
+	fmt.Printf("Root CA: %s\n", report.Subject)
+	fmt.Printf("SHA-256: %s\n\n", report.Fingerprint)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STORE\tSTATE\tLOCATION\tDETAIL")
+	for _, st := range report.Statuses {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", st.Store, st.State, st.Location, st.Detail)
+	}
+	w.Flush()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+
+	"github.com/appremon/apprecert/config"
+	"github.com/appremon/apprecert/truststore"
+)
+
+// reportResults logs the per-store outcome of an install or uninstall.
+func reportResults(action string, results truststore.Results) {
+	for _, res := range results {
+		switch {
+		case res.Skipped:
+			log.Printf("  %-12s skipped (%v)\n", res.Store, res.Err)
+		case res.Err != nil:
+			log.Printf("  %-12s failed: %v\n", res.Store, res.Err)
+		case res.RolledBack:
+			log.Printf("  %-12s %s, then rolled back\n", res.Store, action)
+		default:
+			log.Printf("  %-12s %s\n", res.Store, action)
+		}
+		for _, note := range res.Notes {
+			log.Printf("  %-12s %s\n", "", note)
+		}
+	}
+}
+
+// runRollback handles "apprecert rollback": it reverts an install that was
+// interrupted before it could finish or roll itself back.
+func runRollback(args []string) {
+	fs := flag.NewFlagSet("rollback", flag.ExitOnError)
+	dryRunFlag := fs.Bool("dry-run", false, "Print the changes instead of making them")
+	fs.Parse(args)
+
+	if *dryRunFlag {
+		truststore.SetRunner(truststore.NewRecorder(log.Writer()))
+	}
+	cfg := config.Load()
+	if err := truststore.Rollback(cfg); err != nil {
+		if errors.Is(err, truststore.ErrNoJournal) {
+			log.Println("Nothing to roll back.")
+			return
+		}
+		log.Fatalf("Failed to roll back: %v", err)
+	}
+	if *dryRunFlag {
+		log.Println("Dry run: no changes were made.")
+		return
+	}
+	log.Println("Rolled back the interrupted install.")
+}
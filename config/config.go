@@ -2,23 +2,124 @@ package config
 
 import (
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"runtime"
+
+	"github.com/appremon/apprecert/pkcs8"
+)
+
+// File names inside CAROOT: the per-CAROOT settings and the CA hierarchy.
+const (
+	ConfigFile           = "config.json"
+	RootCertFile         = "rootCA.pem"
+	RootKeyFile          = "rootCA-key.pem"
+	IntermediateCertFile = "intermediateCA.pem"
+	IntermediateKeyFile  = "intermediateCA-key.pem"
 )
 
 // Config represents the application configuration.
 type Config struct {
-	CAROOT string
-	CACert *x509.Certificate
+	CAROOT string            `json:"-"`
+	CACert *x509.Certificate `json:"-"`
+
+	// PassphraseFile holds the CA key passphrase, see Passphrase.
+	PassphraseFile string `json:"-"`
+
+	// Kubeconfig, KubeContext and KubeNamespace select the cluster and
+	// namespace of the kubernetes store; empty means the kubeconfig defaults.
+	Kubeconfig    string `json:"-"`
+	KubeContext   string `json:"-"`
+	KubeNamespace string `json:"-"`
+
+	// KeyType is the default key algorithm for leaf certificates issued
+	// from this CAROOT; empty means the built-in leaf default.
+	KeyType string `json:"keyType,omitempty"`
+
+	// CAKeyType is the key algorithm of the root CA, the default for an
+	// intermediate CA.
+	CAKeyType string `json:"caKeyType,omitempty"`
+
+	// NameConstraints are the X.509 name constraints of the root CA.
+	NameConstraints *NameConstraints `json:"nameConstraints,omitempty"`
+
+	// JavaStorePasswords maps a JDK home or cacerts path to its store
+	// password, for JDKs whose cacerts does not use the default "changeit".
+	JavaStorePasswords map[string]string `json:"javaStorePasswords,omitempty"`
+
+	// PythonPipConf sets pip's cert option in pip.conf to a bundle in CAROOT
+	// instead of adding the root CA to every certifi bundle.
+	PythonPipConf bool `json:"pythonPipConf,omitempty"`
+
+	// GitURLs limits Git's trust in the root CA to these URLs, through
+	// http.<url>.sslCAInfo instead of the global http.sslCAInfo.
+	GitURLs []string `json:"gitURLs,omitempty"`
+
+	// ContainerRegistries are the registries, as host[:port], that Docker,
+	// Podman and containerd trust the root CA for.
+	ContainerRegistries []string `json:"containerRegistries,omitempty"`
+
+	// GitPreviousCAInfo is the global http.sslCAInfo that was replaced on
+	// install, to be restored on uninstall.
+	GitPreviousCAInfo string `json:"gitPreviousCAInfo,omitempty"`
+
+	// NodePreviousExtraCACerts is the NODE_EXTRA_CA_CERTS of the Windows
+	// user environment that was replaced on install, to be restored on
+	// uninstall.
+	NodePreviousExtraCACerts string `json:"nodePreviousExtraCACerts,omitempty"`
+}
+
+// NameConstraints restricts the names a CA may issue certificates for.
+// DNS entries follow RFC 5280: "test" covers test and its subdomains, ".test"
+// only subdomains. IP entries are CIDR ranges.
+type NameConstraints struct {
+	PermittedDNS []string `json:"permittedDNS,omitempty"`
+	ExcludedDNS  []string `json:"excludedDNS,omitempty"`
+	PermittedIPs []string `json:"permittedIPs,omitempty"`
+	ExcludedIPs  []string `json:"excludedIPs,omitempty"`
+}
+
+// Empty reports whether no constraint is set.
+func (nc *NameConstraints) Empty() bool {
+	return len(nc.PermittedDNS)+len(nc.ExcludedDNS)+len(nc.PermittedIPs)+len(nc.ExcludedIPs) == 0
 }
 
 // Load initializes and loads the configuration.
 func Load() *Config {
 	root := getCAROOT()
-	return &Config{CAROOT: root}
+	cfg := &Config{CAROOT: root}
+
+	data, err := os.ReadFile(filepath.Join(root, ConfigFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: failed to read %s: %v", ConfigFile, err)
+		}
+		return cfg
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		log.Printf("Warning: ignoring invalid %s: %v", ConfigFile, err)
+	}
+	// Before caKeyType existed, keyType held the CA's algorithm
+	if cfg.CAKeyType == "" && cfg.KeyType != "" {
+		cfg.CAKeyType, cfg.KeyType = cfg.KeyType, ""
+	}
+	return cfg
+}
+
+// Save writes the per-CAROOT settings to CAROOT/config.json.
+func (cfg *Config) Save() error {
+	if err := cfg.EnsureCAROOT(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(cfg.CAROOT, ConfigFile), append(data, '\n'), 0600)
 }
 
 // getCAROOT determines the default CA root directory.
@@ -39,38 +140,130 @@ func getCAROOT() string {
 	return dir
 }
 
-// LoadCA loads the CA certificate and key from the CAROOT.
+// EnsureCAROOT creates the CAROOT directory, accessible only by the owner.
+func (cfg *Config) EnsureCAROOT() error {
+	if err := os.MkdirAll(cfg.CAROOT, 0700); err != nil {
+		return err
+	}
+	return os.Chmod(cfg.CAROOT, 0700)
+}
+
+// LoadCA loads the root CA certificate and key from the CAROOT.
 func (cfg *Config) LoadCA() (*x509.Certificate, interface{}, error) {
-	certPath := filepath.Join(cfg.CAROOT, "rootCA.pem")
-	keyPath := filepath.Join(cfg.CAROOT, "rootCA-key.pem")
+	caCert, err := cfg.LoadRootCert()
+	if err != nil {
+		return nil, nil, err
+	}
+	caKey, err := cfg.LoadPrivateKey(filepath.Join(cfg.CAROOT, RootKeyFile))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load CA key: %w", err)
+	}
+	return caCert, caKey, nil
+}
+
+// LoadRootCert loads only the root CA certificate, so it works while the
+// root key is kept offline.
+func (cfg *Config) LoadRootCert() (*x509.Certificate, error) {
+	caCert, err := loadCertificate(filepath.Join(cfg.CAROOT, RootCertFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA certificate: %w", err)
+	}
+	return caCert, nil
+}
+
+// HasIntermediate reports whether an intermediate CA exists in CAROOT.
+func (cfg *Config) HasIntermediate() bool {
+	_, err := os.Stat(filepath.Join(cfg.CAROOT, IntermediateCertFile))
+	return err == nil
+}
+
+// LoadIssuer loads the CA that signs leaf certificates: the intermediate CA
+// when one exists, otherwise the root. It also returns the root certificate;
+// the root key is only read when there is no intermediate.
+func (cfg *Config) LoadIssuer() (issuer *x509.Certificate, key interface{}, root *x509.Certificate, err error) {
+	if !cfg.HasIntermediate() {
+		root, key, err = cfg.LoadCA()
+		return root, key, root, err
+	}
+
+	root, err = cfg.LoadRootCert()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	issuer, err = loadCertificate(filepath.Join(cfg.CAROOT, IntermediateCertFile))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to load intermediate CA certificate: %w", err)
+	}
+	key, err = cfg.LoadPrivateKey(filepath.Join(cfg.CAROOT, IntermediateKeyFile))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to load intermediate CA key: %w", err)
+	}
+	return issuer, key, root, nil
+}
 
-	// Load CA certificate
-	certBytes, err := os.ReadFile(certPath)
+// loadCertificate reads a PEM encoded certificate.
+func loadCertificate(path string) (*x509.Certificate, error) {
+	certBytes, err := os.ReadFile(path)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		return nil, err
 	}
 	certBlock, _ := pem.Decode(certBytes)
 	if certBlock == nil || certBlock.Type != "CERTIFICATE" {
-		return nil, nil, fmt.Errorf("invalid CA certificate PEM")
+		return nil, fmt.Errorf("invalid certificate PEM in %s", path)
 	}
-	caCert, err := x509.ParseCertificate(certBlock.Bytes)
+	return x509.ParseCertificate(certBlock.Bytes)
+}
+
+// LoadPrivateKey reads a PEM encoded private key, decrypting it with the CA
+// key passphrase if it is encrypted.
+func (cfg *Config) LoadPrivateKey(path string) (interface{}, error) {
+	keyBytes, err := os.ReadFile(path)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+		return nil, err
+	}
+	keyBlock, _ := pem.Decode(keyBytes)
+	if keyBlock == nil {
+		return nil, fmt.Errorf("invalid key PEM in %s", path)
+	}
+	if keyBlock.Type != pkcs8.PEMType {
+		return parsePrivateKey(keyBlock)
 	}
 
-	// Load CA key
-	keyBytes, err := os.ReadFile(keyPath)
+	pass, err := cfg.Passphrase()
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read CA key: %w", err)
+		return nil, err
 	}
-	keyBlock, _ := pem.Decode(keyBytes)
-	if keyBlock == nil || keyBlock.Type != "PRIVATE KEY" {
-		return nil, nil, fmt.Errorf("invalid CA key PEM")
+	der, err := pkcs8.Decrypt(keyBlock.Bytes, pass)
+	if err != nil {
+		return nil, err
 	}
-	caKey, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	key, err := x509.ParsePKCS8PrivateKey(der)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to parse CA key: %w", err)
+		return nil, pkcs8.ErrIncorrectPassphrase
 	}
+	return key, nil
+}
 
-	return caCert, caKey, nil
+// IsEncryptedKey reports whether the PEM key file at path is encrypted.
+func IsEncryptedKey(path string) bool {
+	keyBytes, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	keyBlock, _ := pem.Decode(keyBytes)
+	return keyBlock != nil && keyBlock.Type == pkcs8.PEMType
+}
+
+// parsePrivateKey parses a PKCS#8, PKCS#1 (RSA) or SEC 1 (EC) private key block.
+func parsePrivateKey(block *pem.Block) (interface{}, error) {
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported key PEM type %q", block.Type)
+	}
 }
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("CAROOT", root)
+	cfg := &Config{
+		CAROOT:              root,
+		KeyType:             "ecdsa-p256",
+		CAKeyType:           "rsa3072",
+		GitURLs:             []string{"https://git.test/"},
+		ContainerRegistries: []string{"registry.test:5000"},
+		JavaStorePasswords:  map[string]string{"/opt/jdk": "s3cret"},
+		NameConstraints:     &NameConstraints{PermittedDNS: []string{".test"}},
+	}
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(root, ConfigFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Fatalf("config.json mode %04o, want 0600", perm)
+	}
+
+	got := Load()
+	if got.CAROOT != root || got.KeyType != cfg.KeyType || got.CAKeyType != cfg.CAKeyType ||
+		got.GitURLs[0] != cfg.GitURLs[0] || got.ContainerRegistries[0] != cfg.ContainerRegistries[0] ||
+		got.JavaStorePasswords["/opt/jdk"] != "s3cret" || got.NameConstraints.PermittedDNS[0] != ".test" {
+		t.Fatalf("Load returned %+v, want %+v", got, cfg)
+	}
+}
+
+func TestLoadLegacyKeyType(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("CAROOT", root)
+	// keyType used to hold the CA's algorithm
+	if err := os.WriteFile(filepath.Join(root, ConfigFile), []byte(`{"keyType": "ed25519"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Load()
+	if cfg.CAKeyType != "ed25519" || cfg.KeyType != "" {
+		t.Fatalf("key types %q/%q, want ed25519 for the CA only", cfg.CAKeyType, cfg.KeyType)
+	}
+}
+
+func TestLoadMissingOrInvalid(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("CAROOT", root)
+	if cfg := Load(); cfg.CAROOT != root || cfg.KeyType != "" {
+		t.Fatalf("Load without config.json: %+v", cfg)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, ConfigFile), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := Load(); cfg.CAROOT != root {
+		t.Fatalf("Load with an invalid config.json: %+v", cfg)
+	}
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// Environment variables that supply the CA key passphrase non-interactively.
+const (
+	PassphraseEnv     = "APPRECERT_CA_PASSPHRASE"
+	PassphraseFileEnv = "APPRECERT_CA_PASSPHRASE_FILE"
+)
+
+// Passphrase returns the passphrase of the encrypted CA key, taken from
+// APPRECERT_CA_PASSPHRASE, the passphrase file, or a terminal prompt.
+func (cfg *Config) Passphrase() ([]byte, error) {
+	if pass, ok, err := cfg.suppliedPassphrase(); ok || err != nil {
+		return pass, err
+	}
+	return promptPassphrase("Enter CA key passphrase: ")
+}
+
+// NewPassphrase returns the passphrase to encrypt a new CA key with, taken
+// from APPRECERT_CA_PASSPHRASE, the passphrase file, or a confirmed prompt.
+func (cfg *Config) NewPassphrase() ([]byte, error) {
+	if pass, ok, err := cfg.suppliedPassphrase(); ok || err != nil {
+		return pass, err
+	}
+	return PromptNewPassphrase()
+}
+
+// suppliedPassphrase looks for a passphrase in the environment or a file.
+func (cfg *Config) suppliedPassphrase() ([]byte, bool, error) {
+	if env := os.Getenv(PassphraseEnv); env != "" {
+		return []byte(env), true, nil
+	}
+	path := cfg.PassphraseFile
+	if path == "" {
+		path = os.Getenv(PassphraseFileEnv)
+	}
+	if path == "" {
+		return nil, false, nil
+	}
+	pass, err := ReadPassphraseFile(path)
+	return pass, true, err
+}
+
+// ReadPassphraseFile reads a passphrase from the first line of a file.
+func ReadPassphraseFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase file: %w", err)
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		data = data[:i]
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("passphrase file %s is empty", path)
+	}
+	return data, nil
+}
+
+// PromptNewPassphrase asks for a new passphrase twice on the terminal.
+func PromptNewPassphrase() ([]byte, error) {
+	pass, err := promptPassphrase("Enter new CA key passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	confirm, err := promptPassphrase("Confirm passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(pass, confirm) {
+		return nil, fmt.Errorf("passphrases do not match")
+	}
+	return pass, nil
+}
+
+// promptPassphrase reads a passphrase from the terminal without echoing it.
+func promptPassphrase(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("the CA key is encrypted and no terminal is available; set %s or %s", PassphraseEnv, PassphraseFileEnv)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	pass, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if len(pass) == 0 {
+		return nil, fmt.Errorf("empty passphrase")
+	}
+	return pass, nil
+}
@@ -0,0 +1,495 @@
+package container
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/appremon/apprecert/utils"
+)
+
+// Media types of the OCI image layout and of the Docker formats it may hold.
+const (
+	ociIndex           = "application/vnd.oci.image.index.v1+json"
+	ociManifest        = "application/vnd.oci.image.manifest.v1+json"
+	ociLayerGzip       = "application/vnd.oci.image.layer.v1.tar+gzip"
+	dockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	dockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerLayerGzip    = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+// refAnnotation names an image in the index.json of a layout.
+const refAnnotation = "org.opencontainers.image.ref.name"
+
+// bundlePaths are the CA bundles of the supported base images, most
+// specific first. Symlinks between them are followed.
+var bundlePaths = []string{
+	"etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", // RHEL, UBI, Fedora
+	"etc/ssl/certs/ca-certificates.crt",                // Debian, Ubuntu, Alpine, distroless
+	"etc/pki/tls/certs/ca-bundle.crt",
+	"etc/ssl/ca-bundle.pem", // SUSE
+	"etc/ssl/cert.pem",
+}
+
+// maxBundleSize bounds the files read from layers as possible bundles.
+const maxBundleSize = 16 << 20
+
+var digestRegexp = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// PatchLayout adds caPEM to the CA bundle of the images in the OCI image
+// layout at dir, or only of the image whose ref.name annotation is ref.
+// Each image gets a new layer holding the updated bundle, with the CA in a
+// managed block that a later patch replaces; the previous blobs are kept. Multi-platform indexes are patched platform by platform.
+// It returns the number of images changed.
+func PatchLayout(dir, ref string, caPEM []byte) (int, error) {
+	if _, err := os.Stat(filepath.Join(dir, "oci-layout")); err != nil {
+		return 0, fmt.Errorf("%s is not an OCI image layout: %w", dir, err)
+	}
+	indexPath := filepath.Join(dir, "index.json")
+	index, err := readJSONFile(indexPath)
+	if err != nil {
+		return 0, err
+	}
+
+	p := &patcher{dir: dir, caPEM: caPEM, created: time.Now().UTC()}
+	matched := false
+	for _, m := range list(index["manifests"]) {
+		desc, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if ref != "" && annotation(desc, refAnnotation) != ref {
+			continue
+		}
+		matched = true
+		if _, err := p.patch(desc); err != nil {
+			return p.changed, err
+		}
+	}
+	if !matched {
+		if ref != "" {
+			return 0, fmt.Errorf("no image %q in %s", ref, dir)
+		}
+		return 0, fmt.Errorf("no images in %s", dir)
+	}
+	if p.changed == 0 {
+		return 0, nil
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(indexPath, data, 0644); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", indexPath, err)
+	}
+	return p.changed, nil
+}
+
+// patcher rewrites the images of one layout.
+type patcher struct {
+	dir     string
+	caPEM   []byte
+	created time.Time
+	changed int
+}
+
+// patch patches the index or manifest desc points to, updating desc to the
+// new blob. It reports whether anything changed.
+func (p *patcher) patch(desc map[string]interface{}) (bool, error) {
+	digest, _ := desc["digest"].(string)
+	doc, err := p.readJSONBlob(digest)
+	if err != nil {
+		return false, err
+	}
+	mediaType, _ := desc["mediaType"].(string)
+	if mediaType == "" {
+		mediaType, _ = doc["mediaType"].(string)
+	}
+
+	var changed bool
+	switch mediaType {
+	case ociIndex, dockerManifestList:
+		for _, m := range list(doc["manifests"]) {
+			child, ok := m.(map[string]interface{})
+			if !ok || annotation(child, "vnd.docker.reference.type") == "attestation-manifest" {
+				continue
+			}
+			childDigest, _ := child["digest"].(string)
+			if !p.hasBlob(childDigest) {
+				log.Printf("Skipping %s %s: not in the layout\n", platform(child), childDigest)
+				continue
+			}
+			childChanged, err := p.patch(child)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || childChanged
+		}
+	case ociManifest, dockerManifest:
+		if changed, err = p.patchImage(doc, mediaType); err != nil {
+			return false, fmt.Errorf("failed to patch image %s: %w", digest, err)
+		}
+		if changed {
+			p.changed++
+		}
+	default:
+		return false, fmt.Errorf("unsupported media type %q of %s", mediaType, digest)
+	}
+	if !changed {
+		return false, nil
+	}
+	return true, p.replaceBlob(desc, doc)
+}
+
+// patchImage adds a layer with the updated CA bundle to manifest and its
+// config. It reports false if the bundle already holds the CA.
+func (p *patcher) patchImage(manifest map[string]interface{}, mediaType string) (bool, error) {
+	configDesc, _ := manifest["config"].(map[string]interface{})
+	configDigest, _ := configDesc["digest"].(string)
+	config, err := p.readJSONBlob(configDigest)
+	if err != nil {
+		return false, err
+	}
+
+	fs := layerFS{}
+	for i, l := range list(manifest["layers"]) {
+		layer, _ := l.(map[string]interface{})
+		layerDigest, _ := layer["digest"].(string)
+		if err := p.readLayer(fs, i, layerDigest); err != nil {
+			return false, err
+		}
+	}
+	name, bundle := fs.findBundle()
+	if bundle == nil {
+		return false, fmt.Errorf("no CA bundle found; install ca-certificates in the image first")
+	}
+	// A CA built into the image, e.g. with the snippet, is left alone; one we
+	// added before is in the managed block and replaced by the current one
+	if _, _, ok := utils.FindBlock(bundle.data); !ok && bytes.Contains(bundle.data, bytes.TrimSpace(p.caPEM)) {
+		return false, nil
+	}
+	data := utils.SetBlock(bundle.data, string(p.caPEM))
+	if bytes.Equal(data, bundle.data) {
+		return false, nil
+	}
+	layer, diffID, err := newLayer(name, bundle.hdr, data, p.created)
+	if err != nil {
+		return false, err
+	}
+	layerDigest, layerSize, err := p.writeBlob(layer)
+	if err != nil {
+		return false, err
+	}
+	layerType := ociLayerGzip
+	if mediaType == dockerManifest {
+		layerType = dockerLayerGzip
+	}
+	manifest["layers"] = append(list(manifest["layers"]), map[string]interface{}{
+		"mediaType": layerType,
+		"digest":    layerDigest,
+		"size":      layerSize,
+	})
+
+	rootfs, _ := config["rootfs"].(map[string]interface{})
+	if rootfs == nil {
+		return false, fmt.Errorf("image config %s has no rootfs", configDigest)
+	}
+	rootfs["diff_ids"] = append(list(rootfs["diff_ids"]), diffID)
+	if history, ok := config["history"].([]interface{}); ok {
+		config["history"] = append(history, map[string]interface{}{
+			"created":    p.created.Format(time.RFC3339),
+			"created_by": "apprecert container patch-oci: add the root CA to /" + name,
+		})
+	}
+	return true, p.replaceBlob(configDesc, config)
+}
+
+// layerFile is a possible CA bundle or a symlink found in a layer.
+type layerFile struct {
+	layer int
+	hdr   *tar.Header
+	data  []byte
+}
+
+// layerFS is the merged view of the files under etc/ that may be or lead
+// to a CA bundle, keyed by their clean path without a leading slash.
+type layerFS map[string]*layerFile
+
+// readLayer applies the layer with the given digest to fs, honouring
+// whiteouts.
+func (p *patcher) readLayer(fs layerFS, index int, digest string) error {
+	f, err := p.openBlob(digest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("failed to read layer %s: %w", digest, err)
+		}
+		defer gz.Close()
+		r = gz
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return fmt.Errorf("layer %s is zstd compressed, which is not supported", digest)
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read layer %s: %w", digest, err)
+		}
+		name := cleanPath(hdr.Name)
+		dir, base := path.Split(name)
+		switch {
+		case base == ".wh..wh..opq":
+			fs.remove(strings.TrimSuffix(dir, "/"), index, false)
+			continue
+		case strings.HasPrefix(base, ".wh."):
+			fs.remove(dir+strings.TrimPrefix(base, ".wh."), index, true)
+			continue
+		}
+
+		delete(fs, name)
+		if !strings.HasPrefix(name, "etc/") {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			fs[name] = &layerFile{layer: index, hdr: hdr}
+		case tar.TypeLink:
+			if target := fs[cleanPath(hdr.Linkname)]; target != nil {
+				fs[name] = &layerFile{layer: index, hdr: target.hdr, data: target.data}
+			}
+		case tar.TypeReg:
+			if hdr.Size > maxBundleSize || !(strings.HasSuffix(name, ".crt") || strings.HasSuffix(name, ".pem")) {
+				continue
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return fmt.Errorf("failed to read layer %s: %w", digest, err)
+			}
+			fs[name] = &layerFile{layer: index, hdr: hdr, data: data}
+		}
+	}
+}
+
+// remove applies a whiteout from layer index: the path itself and what is
+// below it, or for an opaque directory only what lower layers put below it.
+func (fs layerFS) remove(name string, index int, self bool) {
+	for p, f := range fs {
+		if (self && p == name) || (strings.HasPrefix(p, name+"/") && f.layer < index) {
+			delete(fs, p)
+		}
+	}
+}
+
+// findBundle returns the first CA bundle of bundlePaths present in fs, with
+// the path of the regular file holding it.
+func (fs layerFS) findBundle() (string, *layerFile) {
+	for _, name := range bundlePaths {
+		if resolved, ok := fs.resolve(name); ok {
+			if f := fs[resolved]; f != nil && f.hdr.Typeflag == tar.TypeReg {
+				return resolved, f
+			}
+		}
+	}
+	return "", nil
+}
+
+// resolve follows the symlinks in fs along name, including ones of parent
+// directories.
+func (fs layerFS) resolve(name string) (string, bool) {
+	parts := strings.Split(name, "/")
+	cur := ""
+	for hops := 0; len(parts) > 0; {
+		next := path.Join(cur, parts[0])
+		parts = parts[1:]
+		f := fs[next]
+		if f == nil || f.hdr.Typeflag != tar.TypeSymlink {
+			cur = next
+			continue
+		}
+		if hops++; hops > 40 {
+			return "", false
+		}
+		target := f.hdr.Linkname
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(next), target)
+		}
+		parts = append(strings.Split(cleanPath(target), "/"), parts...)
+		cur = ""
+	}
+	return cur, true
+}
+
+// cleanPath normalizes a path in a layer to its clean form without a
+// leading slash.
+func cleanPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// newLayer returns a gzipped layer holding only the file name with data,
+// keeping the ownership and mode of hdr, and the digest of the uncompressed
+// layer, which is its diff ID.
+func newLayer(name string, hdr *tar.Header, data []byte, modTime time.Time) ([]byte, string, error) {
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(data)),
+		Mode:     hdr.Mode,
+		Uid:      hdr.Uid,
+		Gid:      hdr.Gid,
+		Uname:    hdr.Uname,
+		Gname:    hdr.Gname,
+		ModTime:  modTime,
+		Format:   tar.FormatPAX,
+	})
+	if err == nil {
+		_, err = tw.Write(data)
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create layer: %w", err)
+	}
+	sum := sha256.Sum256(tarBuf.Bytes())
+
+	var gzBuf bytes.Buffer
+	gz := gzip.NewWriter(&gzBuf)
+	if _, err := gz.Write(tarBuf.Bytes()); err != nil {
+		return nil, "", fmt.Errorf("failed to compress layer: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, "", fmt.Errorf("failed to compress layer: %w", err)
+	}
+	return gzBuf.Bytes(), "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// blobPath returns the path of the blob with the given digest.
+func (p *patcher) blobPath(digest string) (string, error) {
+	if !digestRegexp.MatchString(digest) {
+		return "", fmt.Errorf("unsupported digest %q", digest)
+	}
+	return filepath.Join(p.dir, "blobs", "sha256", strings.TrimPrefix(digest, "sha256:")), nil
+}
+
+func (p *patcher) hasBlob(digest string) bool {
+	blob, err := p.blobPath(digest)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(blob)
+	return err == nil
+}
+
+func (p *patcher) openBlob(digest string) (*os.File, error) {
+	blob, err := p.blobPath(digest)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(blob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob: %w", err)
+	}
+	return f, nil
+}
+
+func (p *patcher) readJSONBlob(digest string) (map[string]interface{}, error) {
+	blob, err := p.blobPath(digest)
+	if err != nil {
+		return nil, err
+	}
+	return readJSONFile(blob)
+}
+
+// writeBlob stores data as a blob and returns its digest and size.
+func (p *patcher) writeBlob(data []byte) (string, int64, error) {
+	sum := sha256.Sum256(data)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	blob, _ := p.blobPath(digest)
+	if err := os.WriteFile(blob, data, 0644); err != nil {
+		return "", 0, fmt.Errorf("failed to write blob: %w", err)
+	}
+	return digest, int64(len(data)), nil
+}
+
+// replaceBlob stores doc as a new blob and points desc at it.
+func (p *patcher) replaceBlob(desc, doc map[string]interface{}) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	digest, size, err := p.writeBlob(data)
+	if err != nil {
+		return err
+	}
+	desc["digest"], desc["size"] = digest, size
+	return nil
+}
+
+// readJSONFile decodes a JSON object, keeping numbers as written.
+func readJSONFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// list returns v as a JSON array, or nil if it is not one.
+func list(v interface{}) []interface{} {
+	l, _ := v.([]interface{})
+	return l
+}
+
+// annotation returns an annotation of a descriptor.
+func annotation(desc map[string]interface{}, key string) string {
+	annotations, _ := desc["annotations"].(map[string]interface{})
+	value, _ := annotations[key].(string)
+	return value
+}
+
+// platform describes the platform of a descriptor in an index, e.g.
+// "linux/arm64".
+func platform(desc map[string]interface{}) string {
+	pl, _ := desc["platform"].(map[string]interface{})
+	goos, _ := pl["os"].(string)
+	arch, _ := pl["architecture"].(string)
+	if variant, _ := pl["variant"].(string); variant != "" {
+		arch += "/" + variant
+	}
+	return goos + "/" + arch
+}
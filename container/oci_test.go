@@ -0,0 +1,220 @@
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	systemRoots = "-----BEGIN CERTIFICATE-----\nc3lzdGVt\n-----END CERTIFICATE-----\n"
+	firstCA     = "-----BEGIN CERTIFICATE-----\nZmlyc3Q=\n-----END CERTIFICATE-----\n"
+	secondCA    = "-----BEGIN CERTIFICATE-----\nc2Vjb25k\n-----END CERTIFICATE-----\n"
+)
+
+// writeTestBlob stores v, or data if v is a byte slice, as a blob of the
+// layout at dir and returns its descriptor.
+func writeTestBlob(t *testing.T, dir, mediaType string, v interface{}) map[string]interface{} {
+	t.Helper()
+	data, ok := v.([]byte)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sum := sha256.Sum256(data)
+	blob := filepath.Join(dir, "blobs", "sha256", hex.EncodeToString(sum[:]))
+	if err := os.WriteFile(blob, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return map[string]interface{}{
+		"mediaType": mediaType,
+		"digest":    "sha256:" + hex.EncodeToString(sum[:]),
+		"size":      len(data),
+	}
+}
+
+// newTestLayout creates an OCI layout with one image, tagged "test", whose
+// only layer holds a Debian style CA bundle, and returns its directory.
+func newTestLayout(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var tarBuf bytes.Buffer
+	tw := tar.NewWriter(&tarBuf)
+	for _, hdr := range []*tar.Header{
+		{Typeflag: tar.TypeDir, Name: "etc/ssl/certs/", Mode: 0755},
+		{Typeflag: tar.TypeReg, Name: "etc/ssl/certs/ca-certificates.crt", Mode: 0644, Size: int64(len(systemRoots))},
+	} {
+		hdr.ModTime = time.Unix(0, 0)
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tw.Write([]byte(systemRoots)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	diffID := sha256.Sum256(tarBuf.Bytes())
+	var gzBuf bytes.Buffer
+	gz := gzip.NewWriter(&gzBuf)
+	gz.Write(tarBuf.Bytes())
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	layer := writeTestBlob(t, dir, ociLayerGzip, gzBuf.Bytes())
+	config := writeTestBlob(t, dir, "application/vnd.oci.image.config.v1+json", map[string]interface{}{
+		"architecture": "amd64",
+		"os":           "linux",
+		"rootfs":       map[string]interface{}{"type": "layers", "diff_ids": []string{"sha256:" + hex.EncodeToString(diffID[:])}},
+		"history":      []interface{}{map[string]interface{}{"created_by": "test"}},
+	})
+	manifest := writeTestBlob(t, dir, ociManifest, map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     ociManifest,
+		"config":        config,
+		"layers":        []interface{}{layer},
+	})
+	manifest["annotations"] = map[string]string{refAnnotation: "test"}
+	index, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     ociIndex,
+		"manifests":     []interface{}{manifest},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), index, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// readImage returns the CA bundle and the diff IDs of the image in the
+// layout at dir, checking each diff ID against its layer.
+func readImage(t *testing.T, dir string) (string, []interface{}) {
+	t.Helper()
+	p := &patcher{dir: dir}
+	index, err := readJSONFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := list(index["manifests"])[0].(map[string]interface{})
+	manifest, err := p.readJSONBlob(desc["digest"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := p.readJSONBlob(manifest["config"].(map[string]interface{})["digest"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffIDs := list(config["rootfs"].(map[string]interface{})["diff_ids"])
+
+	layers := list(manifest["layers"])
+	if len(layers) != len(diffIDs) {
+		t.Fatalf("%d layers but %d diff IDs", len(layers), len(diffIDs))
+	}
+	fs := layerFS{}
+	for i, l := range layers {
+		digest := l.(map[string]interface{})["digest"].(string)
+		if err := p.readLayer(fs, i, digest); err != nil {
+			t.Fatal(err)
+		}
+		f, err := p.openBlob(digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, gz); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		if want := "sha256:" + hex.EncodeToString(h.Sum(nil)); diffIDs[i] != want {
+			t.Fatalf("diff ID %d is %s, want %s", i, diffIDs[i], want)
+		}
+	}
+	name, bundle := fs.findBundle()
+	if name != "etc/ssl/certs/ca-certificates.crt" {
+		t.Fatalf("bundle found at %q", name)
+	}
+	return string(bundle.data), diffIDs
+}
+
+func TestPatchLayout(t *testing.T) {
+	dir := newTestLayout(t)
+
+	n, err := PatchLayout(dir, "test", []byte(firstCA))
+	if err != nil || n != 1 {
+		t.Fatalf("PatchLayout: %d images, %v", n, err)
+	}
+	bundle, diffIDs := readImage(t, dir)
+	if want := systemRoots + "# BEGIN apprecert\n" + firstCA + "# END apprecert\n"; bundle != want {
+		t.Fatalf("bundle after patch:\n%s", bundle)
+	}
+	if len(diffIDs) != 2 {
+		t.Fatalf("diff IDs %v, want the new layer appended", diffIDs)
+	}
+
+	// Patching again with the same CA changes nothing
+	if n, err := PatchLayout(dir, "", []byte(firstCA)); err != nil || n != 0 {
+		t.Fatalf("PatchLayout again: %d images, %v", n, err)
+	}
+
+	// A new CA replaces the previous one
+	if n, err := PatchLayout(dir, "test", []byte(secondCA)); err != nil || n != 1 {
+		t.Fatalf("PatchLayout with a new CA: %d images, %v", n, err)
+	}
+	bundle, diffIDs = readImage(t, dir)
+	if want := systemRoots + "# BEGIN apprecert\n" + secondCA + "# END apprecert\n"; bundle != want {
+		t.Fatalf("bundle after patching with a new CA:\n%s", bundle)
+	}
+	if len(diffIDs) != 3 {
+		t.Fatalf("diff IDs %v, want three layers", diffIDs)
+	}
+}
+
+func TestPatchLayoutUnknownRef(t *testing.T) {
+	dir := newTestLayout(t)
+	if _, err := PatchLayout(dir, "other", []byte(firstCA)); err == nil || !strings.Contains(err.Error(), `no image "other"`) {
+		t.Fatalf("PatchLayout: got %v, want an unknown ref error", err)
+	}
+}
+
+func TestSnippetDistroless(t *testing.T) {
+	snippet, err := Snippet("distroless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(snippet, "AS "+HelperStage+"\n") || !strings.Contains(snippet, "COPY --from="+HelperStage+" ") {
+		t.Fatalf("distroless snippet does not name and use the %s stage:\n%s", HelperStage, snippet)
+	}
+	if strings.Contains(snippet, "%!") {
+		t.Fatalf("bad snippet:\n%s", snippet)
+	}
+	if _, err := Snippet("ubuntu"); err != nil {
+		t.Fatalf("Snippet(ubuntu): %v", err)
+	}
+}
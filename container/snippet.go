@@ -0,0 +1,85 @@
+// Package container makes container images trust the root CA, either at
+// build time through a Dockerfile fragment or by adding a layer to an
+// image in an OCI layout directory.
+package container
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CAFile is the name of the root CA in the build context.
+const CAFile = "apprecert-ca.crt"
+
+// HelperStage is the name of the build stage that the distroless snippet
+// builds the CA bundle in and copies it from.
+const HelperStage = "apprecert-ca"
+
+// snippets holds the Dockerfile fragment for each base image family. %[1]s
+// is the CA file in the build context and %[2]s the helper stage.
+var snippets = map[string]string{
+	"debian": `# Trust the apprecert root CA (Debian, Ubuntu)
+COPY %[1]s /usr/local/share/ca-certificates/%[1]s
+RUN apt-get update \
+ && apt-get install -y --no-install-recommends ca-certificates \
+ && rm -rf /var/lib/apt/lists/* \
+ && update-ca-certificates
+`,
+	"alpine": `# Trust the apprecert root CA (Alpine)
+COPY %[1]s /usr/local/share/ca-certificates/%[1]s
+RUN apk add --no-cache ca-certificates \
+ && update-ca-certificates
+`,
+	"rhel": `# Trust the apprecert root CA (RHEL, UBI, Fedora, CentOS Stream), as root
+COPY %[1]s /etc/pki/ca-trust/source/anchors/%[1]s
+RUN update-ca-trust
+`,
+	"distroless": `# Trust the apprecert root CA (distroless). Distroless images have no shell
+# or update-ca-certificates, so the bundle is built in the %[2]s stage.
+# Put this stage before the FROM line of the distroless stage:
+FROM debian:stable-slim AS %[2]s
+RUN apt-get update \
+ && apt-get install -y --no-install-recommends ca-certificates
+COPY %[1]s /usr/local/share/ca-certificates/%[1]s
+RUN update-ca-certificates
+
+# and this line after the FROM line of the distroless stage:
+COPY --from=%[2]s /etc/ssl/certs/ca-certificates.crt /etc/ssl/certs/ca-certificates.crt
+`,
+}
+
+// distroAliases maps other names of a base image family to its snippet.
+var distroAliases = map[string]string{
+	"ubuntu": "debian",
+	"ubi":    "rhel",
+	"fedora": "rhel",
+	"centos": "rhel",
+}
+
+// Distros lists the base image families Snippet accepts.
+func Distros() []string {
+	var names []string
+	for name := range snippets {
+		names = append(names, name)
+	}
+	for name := range distroAliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Snippet returns the Dockerfile fragment that adds CAFile from the build
+// context to the trust store of an image based on distro.
+func Snippet(distro string) (string, error) {
+	distro = strings.ToLower(distro)
+	if alias, ok := distroAliases[distro]; ok {
+		distro = alias
+	}
+	snippet, ok := snippets[distro]
+	if !ok {
+		return "", fmt.Errorf("unknown distro %q, expected one of %s", distro, strings.Join(Distros(), ", "))
+	}
+	return fmt.Sprintf(snippet, CAFile, HelperStage), nil
+}
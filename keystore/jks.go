@@ -0,0 +1,179 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	jksMagic   = 0xFEEDFEED
+	jceksMagic = 0xCECECECE
+
+	jksPrivateKeyTag  = 1
+	jksTrustedCertTag = 2
+)
+
+// jksDigest computes the integrity check of a JKS file: SHA-1 over the
+// password in UTF-16BE, the string "Mighty Aphrodite" and the contents.
+func jksDigest(data []byte, password string) []byte {
+	h := sha1.New()
+	for _, c := range utf16.Encode([]rune(password)) {
+		h.Write([]byte{byte(c >> 8), byte(c)})
+	}
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// jksReader reads the big-endian fields of a JKS file.
+type jksReader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (r *jksReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.off+n > len(r.data) {
+		r.err = errors.New("keystore: truncated JKS file")
+		return nil
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *jksReader) uint16() int {
+	if b := r.next(2); b != nil {
+		return int(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *jksReader) uint32() int {
+	if b := r.next(4); b != nil {
+		return int(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *jksReader) int64() int64 {
+	if b := r.next(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// utf reads a Java modified UTF-8 string; for the ASCII aliases and
+// certificate types found in practice it is plain UTF-8.
+func (r *jksReader) utf() string {
+	return string(r.next(r.uint16()))
+}
+
+// cert reads a certificate, preceded by its type in version 2 files.
+func (r *jksReader) cert(version int) []byte {
+	if version == 2 {
+		if typ := r.utf(); typ != "X.509" && r.err == nil {
+			r.err = fmt.Errorf("keystore: unsupported certificate type %q", typ)
+		}
+	}
+	return r.next(r.uint32())
+}
+
+func decodeJKS(data []byte, password string) (*KeyStore, error) {
+	if len(data) < sha1.Size {
+		return nil, errors.New("keystore: truncated JKS file")
+	}
+	body, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	if subtle.ConstantTimeCompare(jksDigest(body, password), digest) != 1 {
+		return nil, ErrIncorrectPassword
+	}
+
+	r := &jksReader{data: body}
+	r.uint32() // magic
+	version := r.uint32()
+	if version != 1 && version != 2 {
+		return nil, fmt.Errorf("keystore: unsupported JKS version %d", version)
+	}
+	ks := &KeyStore{Format: JKS}
+	for n := r.uint32(); n > 0 && r.err == nil; n-- {
+		tag := r.uint32()
+		e := entry{alias: r.utf(), created: time.UnixMilli(r.int64())}
+		switch tag {
+		case jksPrivateKeyTag:
+			start := r.off
+			r.next(r.uint32()) // encrypted key
+			for chain := r.uint32(); chain > 0 && r.err == nil; chain-- {
+				r.cert(version)
+			}
+			e.keyData = body[start:r.off]
+			if version == 1 {
+				return nil, errors.New("keystore: private key entries in version 1 JKS files are not supported")
+			}
+		case jksTrustedCertTag:
+			der := r.cert(version)
+			if r.err != nil {
+				break
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, fmt.Errorf("keystore: invalid certificate %q: %w", e.alias, err)
+			}
+			e.cert = cert
+		default:
+			return nil, fmt.Errorf("keystore: unknown JKS entry type %d", tag)
+		}
+		ks.entries = append(ks.entries, e)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return ks, nil
+}
+
+func (ks *KeyStore) encodeJKS(password string) ([]byte, error) {
+	var buf bytes.Buffer
+	put := func(v interface{}) { binary.Write(&buf, binary.BigEndian, v) }
+	putUTF := func(s string) {
+		put(uint16(len(s)))
+		buf.WriteString(s)
+	}
+
+	put(uint32(jksMagic))
+	put(uint32(2))
+	put(uint32(len(ks.entries)))
+	for _, e := range ks.entries {
+		if len(e.alias) > 0xFFFF {
+			return nil, fmt.Errorf("keystore: alias too long")
+		}
+		if e.cert != nil {
+			put(uint32(jksTrustedCertTag))
+		} else {
+			put(uint32(jksPrivateKeyTag))
+		}
+		putUTF(e.alias)
+		created := e.created
+		if created.IsZero() {
+			created = time.Now()
+		}
+		put(created.UnixMilli())
+		if e.cert == nil {
+			buf.Write(e.keyData)
+			continue
+		}
+		putUTF("X.509")
+		put(uint32(len(e.cert.Raw)))
+		buf.Write(e.cert.Raw)
+	}
+	buf.Write(jksDigest(buf.Bytes(), password))
+	return buf.Bytes(), nil
+}
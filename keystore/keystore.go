@@ -0,0 +1,146 @@
+// Package keystore reads and writes Java trust stores, such as a JDK's
+// cacerts file, in the JKS and PKCS#12 formats, so trusted certificates can
+// be added and removed without keytool.
+//
+// Private key entries of JKS files are preserved as-is but cannot be
+// created; PKCS#12 files may only contain trusted certificates, and are
+// only written back if they use PBES2 or no encryption.
+package keystore
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Format is the file format of a key store.
+type Format int
+
+// Supported key store formats.
+const (
+	JKS Format = iota
+	PKCS12
+)
+
+func (f Format) String() string {
+	if f == JKS {
+		return "JKS"
+	}
+	return "PKCS12"
+}
+
+// ErrIncorrectPassword is returned when the store password does not match.
+var ErrIncorrectPassword = errors.New("keystore: incorrect store password")
+
+// ErrLegacyEncryption is returned by Encode for a PKCS#12 store whose
+// certificates are encrypted with a legacy scheme, such as RC2 or 3DES,
+// since their aliases could not be read and would be lost.
+var ErrLegacyEncryption = errors.New("keystore: PKCS#12 store uses legacy encryption, its aliases cannot be preserved")
+
+// entry is one aliased entry of a key store.
+type entry struct {
+	alias   string
+	created time.Time
+	cert    *x509.Certificate // nil for a private key entry
+	keyData []byte            // serialized JKS private key entry, preserved as-is
+}
+
+// KeyStore is a decoded Java key store.
+type KeyStore struct {
+	Format Format
+
+	// Passwordless marks a PKCS#12 store without a MAC, as shipped by JDK 18
+	// and later; it accepts any password and is written back the same way.
+	Passwordless bool
+
+	entries     []entry
+	aliasesLost bool // some PKCS#12 aliases could not be read
+}
+
+// Decode parses a JKS or PKCS#12 key store, verifying its integrity with
+// password.
+func Decode(data []byte, password string) (*KeyStore, error) {
+	if len(data) >= 4 {
+		switch binary.BigEndian.Uint32(data) {
+		case jksMagic:
+			return decodeJKS(data, password)
+		case jceksMagic:
+			return nil, errors.New("keystore: JCEKS key stores are not supported")
+		}
+	}
+	return decodePKCS12(data, password)
+}
+
+// Encode serializes the key store in its format, protected by password.
+func (ks *KeyStore) Encode(password string) ([]byte, error) {
+	if ks.Format == JKS {
+		return ks.encodeJKS(password)
+	}
+	return ks.encodePKCS12(password)
+}
+
+// Aliases returns the aliases of all entries.
+func (ks *KeyStore) Aliases() []string {
+	aliases := make([]string, len(ks.entries))
+	for i, e := range ks.entries {
+		aliases[i] = e.alias
+	}
+	return aliases
+}
+
+// find returns the index of the entry with alias, compared case-insensitively
+// like Java does, or -1.
+func (ks *KeyStore) find(alias string) int {
+	for i, e := range ks.entries {
+		if strings.EqualFold(e.alias, alias) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Certificate returns the trusted certificate stored under alias.
+func (ks *KeyStore) Certificate(alias string) (*x509.Certificate, bool) {
+	if i := ks.find(alias); i >= 0 && ks.entries[i].cert != nil {
+		return ks.entries[i].cert, true
+	}
+	return nil, false
+}
+
+// HasCertificate reports whether cert is trusted under any alias.
+func (ks *KeyStore) HasCertificate(cert *x509.Certificate) bool {
+	for _, e := range ks.entries {
+		if e.cert != nil && bytes.Equal(e.cert.Raw, cert.Raw) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetCertificate stores cert as a trusted certificate under alias,
+// replacing any existing entry with that alias.
+func (ks *KeyStore) SetCertificate(alias string, cert *x509.Certificate) {
+	e := entry{alias: alias, created: time.Now(), cert: cert}
+	if ks.Format == JKS {
+		// JKS aliases are case-insensitive and stored in lower case
+		e.alias = strings.ToLower(alias)
+	}
+	if i := ks.find(alias); i >= 0 {
+		ks.entries[i] = e
+		return
+	}
+	ks.entries = append(ks.entries, e)
+}
+
+// Delete removes the entry with alias and reports whether there was one.
+func (ks *KeyStore) Delete(alias string) bool {
+	i := ks.find(alias)
+	if i < 0 {
+		return false
+	}
+	ks.entries = append(ks.entries[:i], ks.entries[i+1:]...)
+	return true
+}
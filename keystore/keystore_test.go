@@ -0,0 +1,166 @@
+package keystore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func testCert(t *testing.T, cn string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// roundTrip encodes ks with password and decodes the result.
+func roundTrip(t *testing.T, ks *KeyStore, password string) *KeyStore {
+	t.Helper()
+	data, err := ks.Encode(password)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	decoded, err := Decode(data, password)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if decoded.Format != ks.Format {
+		t.Fatalf("format %v after round trip, want %v", decoded.Format, ks.Format)
+	}
+	return decoded
+}
+
+func TestJKSRoundTrip(t *testing.T) {
+	root, other := testCert(t, "Test Root"), testCert(t, "Other")
+	ks := &KeyStore{Format: JKS}
+	ks.SetCertificate("Other", other)
+	ks.SetCertificate("MyRoot", root)
+
+	decoded := roundTrip(t, ks, "changeit")
+	if got := decoded.Aliases(); len(got) != 2 || got[0] != "other" || got[1] != "myroot" {
+		t.Fatalf("aliases %q, want [other myroot]", got)
+	}
+	if cert, ok := decoded.Certificate("MYROOT"); !ok || !cert.Equal(root) {
+		t.Fatal("root certificate not found under its alias")
+	}
+
+	if !decoded.Delete("myroot") {
+		t.Fatal("Delete found no entry")
+	}
+	decoded = roundTrip(t, decoded, "changeit")
+	if decoded.HasCertificate(root) || !decoded.HasCertificate(other) {
+		t.Fatal("Delete removed the wrong entry")
+	}
+}
+
+func TestJKSWrongPassword(t *testing.T) {
+	ks := &KeyStore{Format: JKS}
+	ks.SetCertificate("root", testCert(t, "Test Root"))
+	data, err := ks.Encode("changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decode(data, "wrong"); !errors.Is(err, ErrIncorrectPassword) {
+		t.Fatalf("Decode with the wrong password: got %v, want ErrIncorrectPassword", err)
+	}
+}
+
+func TestPKCS12RoundTrip(t *testing.T) {
+	root, other := testCert(t, "Test Root"), testCert(t, "Other")
+	ks := &KeyStore{Format: PKCS12}
+	ks.SetCertificate("Other", other)
+	ks.SetCertificate("MyRoot", root)
+
+	decoded := roundTrip(t, ks, "s3cret")
+	if decoded.Passwordless {
+		t.Fatal("store decoded as passwordless")
+	}
+	if got := decoded.Aliases(); len(got) != 2 || got[0] != "Other" || got[1] != "MyRoot" {
+		t.Fatalf("aliases %q, want [Other MyRoot]", got)
+	}
+	if cert, ok := decoded.Certificate("myroot"); !ok || !cert.Equal(root) {
+		t.Fatal("root certificate not found under its alias")
+	}
+
+	data, err := decoded.Encode("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decode(data, "wrong"); !errors.Is(err, ErrIncorrectPassword) {
+		t.Fatalf("Decode with the wrong password: got %v, want ErrIncorrectPassword", err)
+	}
+}
+
+func TestPasswordlessPKCS12RoundTrip(t *testing.T) {
+	root := testCert(t, "Test Root")
+	ks := &KeyStore{Format: PKCS12, Passwordless: true}
+	ks.SetCertificate("myroot", root)
+
+	data, err := ks.Encode("changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without a MAC, any password opens the store
+	decoded, err := Decode(data, "anything")
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !decoded.Passwordless {
+		t.Fatal("store not decoded as passwordless")
+	}
+	if cert, ok := decoded.Certificate("myroot"); !ok || !cert.Equal(root) {
+		t.Fatal("root certificate not found under its alias")
+	}
+	if !roundTrip(t, decoded, "changeit").Passwordless {
+		t.Fatal("store not written back as passwordless")
+	}
+}
+
+func TestLegacyPKCS12IsNotRewritten(t *testing.T) {
+	root := testCert(t, "Test Root")
+	for name, enc := range map[string]*pkcs12.Encoder{"RC2": pkcs12.LegacyRC2, "3DES": pkcs12.LegacyDES} {
+		t.Run(name, func(t *testing.T) {
+			data, err := enc.WithRand(rand.Reader).EncodeTrustStoreEntries(
+				[]pkcs12.TrustStoreEntry{{Cert: root, FriendlyName: "myroot"}}, "changeit")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ks, err := Decode(data, "changeit")
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if !ks.HasCertificate(root) {
+				t.Fatal("certificate not decoded")
+			}
+			if _, err := ks.Encode("changeit"); !errors.Is(err, ErrLegacyEncryption) {
+				t.Fatalf("Encode: got %v, want ErrLegacyEncryption", err)
+			}
+		})
+	}
+}
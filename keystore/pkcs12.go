@@ -0,0 +1,190 @@
+package keystore
+
+import (
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/appremon/apprecert/pkcs8"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var (
+	oidDataContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedDataContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidCertBag                  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidFriendlyName             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidPBES2                    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+)
+
+// The subset of PKCS#12 (RFC 7292) needed to read entry aliases, which
+// go-pkcs12 does not expose.
+type pfxPDU struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type encryptedData struct {
+	Version              int
+	EncryptedContentInfo struct {
+		ContentType                asn1.ObjectIdentifier
+		ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+		EncryptedContent           []byte `asn1:"tag:0,optional"`
+	}
+}
+
+type safeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue `asn1:"tag:0,explicit"`
+	Attributes []attribute   `asn1:"set,optional"`
+}
+
+type attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type certBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Data      []byte
+}
+
+func decodePKCS12(data []byte, password string) (*KeyStore, error) {
+	var pfx pfxPDU
+	if _, err := asn1.Unmarshal(data, &pfx); err != nil {
+		return nil, fmt.Errorf("keystore: not a JKS or PKCS#12 file: %w", err)
+	}
+	ks := &KeyStore{Format: PKCS12, Passwordless: len(pfx.MacData.FullBytes) == 0}
+	if ks.Passwordless {
+		password = ""
+	}
+
+	// go-pkcs12 verifies the MAC and decrypts every supported scheme
+	certs, err := pkcs12.DecodeTrustStore(data, password)
+	if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+		return nil, ErrIncorrectPassword
+	}
+	if err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+
+	aliases := pkcs12Aliases(pfx, password)
+	for _, cert := range certs {
+		alias, ok := aliases[string(cert.Raw)]
+		if !ok {
+			// Only lost for certificates encrypted with legacy schemes; the
+			// stand-in serves lookups, but the store cannot be written back
+			alias = strings.ToLower(cert.Subject.CommonName)
+			ks.aliasesLost = true
+		}
+		ks.entries = append(ks.entries, entry{alias: alias, cert: cert})
+	}
+	return ks, nil
+}
+
+// pkcs12Aliases maps the DER of each certificate to its friendly name, as
+// far as the safe contents are unencrypted or encrypted with PBES2.
+func pkcs12Aliases(pfx pfxPDU, password string) map[string]string {
+	aliases := make(map[string]string)
+	var authSafeData []byte
+	if _, err := asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &authSafeData); err != nil {
+		return aliases
+	}
+	var authSafe []contentInfo
+	if _, err := asn1.Unmarshal(authSafeData, &authSafe); err != nil {
+		return aliases
+	}
+
+	for _, ci := range authSafe {
+		var contents []byte
+		switch {
+		case ci.ContentType.Equal(oidDataContentType):
+			if _, err := asn1.Unmarshal(ci.Content.Bytes, &contents); err != nil {
+				continue
+			}
+		case ci.ContentType.Equal(oidEncryptedDataContentType):
+			var ed encryptedData
+			if _, err := asn1.Unmarshal(ci.Content.Bytes, &ed); err != nil {
+				continue
+			}
+			eci := ed.EncryptedContentInfo
+			if !eci.ContentEncryptionAlgorithm.Algorithm.Equal(oidPBES2) {
+				continue
+			}
+			der, err := asn1.Marshal(encryptedPrivateKeyInfo{eci.ContentEncryptionAlgorithm, eci.EncryptedContent})
+			if err != nil {
+				continue
+			}
+			if contents, err = pkcs8.Decrypt(der, []byte(password)); err != nil {
+				continue
+			}
+		default:
+			continue
+		}
+
+		var bags []safeBag
+		if _, err := asn1.Unmarshal(contents, &bags); err != nil {
+			continue
+		}
+		for _, bag := range bags {
+			var cb certBag
+			if !bag.ID.Equal(oidCertBag) {
+				continue
+			}
+			if _, err := asn1.Unmarshal(bag.Value.Bytes, &cb); err != nil {
+				continue
+			}
+			for _, attr := range bag.Attributes {
+				if name, ok := bmpString(attr); ok && attr.ID.Equal(oidFriendlyName) {
+					aliases[string(cb.Data)] = name
+				}
+			}
+		}
+	}
+	return aliases
+}
+
+// bmpString decodes a single BMPString attribute value.
+func bmpString(attr attribute) (string, bool) {
+	var raw asn1.RawValue
+	if _, err := asn1.Unmarshal(attr.Value.Bytes, &raw); err != nil || raw.Tag != asn1.TagBMPString || len(raw.Bytes)%2 != 0 {
+		return "", false
+	}
+	s := make([]uint16, len(raw.Bytes)/2)
+	for i := range s {
+		s[i] = uint16(raw.Bytes[2*i])<<8 | uint16(raw.Bytes[2*i+1])
+	}
+	return string(utf16.Decode(s)), true
+}
+
+func (ks *KeyStore) encodePKCS12(password string) ([]byte, error) {
+	if ks.aliasesLost {
+		return nil, ErrLegacyEncryption
+	}
+	entries := make([]pkcs12.TrustStoreEntry, 0, len(ks.entries))
+	for _, e := range ks.entries {
+		if e.cert == nil {
+			return nil, errors.New("keystore: PKCS#12 private key entries are not supported")
+		}
+		entries = append(entries, pkcs12.TrustStoreEntry{Cert: e.cert, FriendlyName: e.alias})
+	}
+	if ks.Passwordless {
+		return pkcs12.Passwordless.WithRand(rand.Reader).EncodeTrustStoreEntries(entries, "")
+	}
+	return pkcs12.Modern.WithRand(rand.Reader).EncodeTrustStoreEntries(entries, password)
+}
@@ -0,0 +1,46 @@
+package kube
+
+import "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+// CertManager describes the objects that let cert-manager issue certificates
+// from a local CA and trust-manager distribute its root certificate:
+//
+//   - a kubernetes.io/tls Secret holding the issuing CA in Namespace,
+//   - a ClusterIssuer of type CA reading that Secret,
+//   - a Bundle copying the root certificate from the Secret into a ConfigMap
+//     in every namespace.
+//
+// All three are called Name. Namespace must be cert-manager's cluster
+// resource namespace, which is also trust-manager's trust namespace by
+// default.
+type CertManager struct {
+	Name      string
+	Namespace string
+	CertPEM   []byte // the issuing CA certificate, followed by its chain
+	KeyPEM    []byte // the unencrypted issuing CA key
+	RootPEM   []byte // the root certificate to trust
+}
+
+// Objects returns the Secret, ClusterIssuer and Bundle, in the order they
+// are applied.
+func (c CertManager) Objects() []*unstructured.Unstructured {
+	secret := TLSSecret(c.Namespace, c.Name, c.CertPEM, c.KeyPEM, c.RootPEM)
+
+	issuer := newObject("cert-manager.io/v1", "ClusterIssuer", "", c.Name)
+	issuer.Object["spec"] = map[string]interface{}{
+		"ca": map[string]interface{}{"secretName": c.Name},
+	}
+
+	bundle := newObject("trust.cert-manager.io/v1alpha1", "Bundle", "", c.Name)
+	bundle.Object["spec"] = map[string]interface{}{
+		"sources": []interface{}{
+			map[string]interface{}{
+				"secret": map[string]interface{}{"name": c.Name, "key": "ca.crt"},
+			},
+		},
+		"target": map[string]interface{}{
+			"configMap": map[string]interface{}{"key": "ca.crt"},
+		},
+	}
+	return []*unstructured.Unstructured{secret, issuer, bundle}
+}
@@ -0,0 +1,208 @@
+// Package kube connects to the Kubernetes cluster selected by a kubeconfig,
+// context and namespace, like kubectl does, and creates or updates the
+// objects apprecert publishes there.
+package kube
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Timeout bounds each request to the cluster.
+const Timeout = 10 * time.Second
+
+// Options selects a cluster and namespace. Empty fields fall back to the
+// kubeconfig defaults: KUBECONFIG or ~/.kube/config, its current context and
+// that context's namespace.
+type Options struct {
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	Context    string `json:"context,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+}
+
+// Factory creates a client for the cluster selected by opts and returns it
+// with the namespace to use.
+type Factory func(opts Options) (kubernetes.Interface, string, error)
+
+// DynamicFactory is like Factory for the dynamic client, which handles
+// custom resources such as cert-manager's.
+type DynamicFactory func(opts Options) (dynamic.Interface, string, error)
+
+var (
+	factoryMu      sync.Mutex
+	factory        Factory        = newClientset
+	dynamicFactory DynamicFactory = newDynamicClient
+)
+
+// SetFactory replaces the Factory used by NewClient and returns the previous
+// one. Tests use it to substitute a fake clientset:
+//
+//	kube.SetFactory(func(opts kube.Options) (kubernetes.Interface, string, error) {
+//		return fake.NewSimpleClientset(), opts.Namespace, nil
+//	})
+func SetFactory(f Factory) Factory {
+	factoryMu.Lock()
+	defer factoryMu.Unlock()
+	prev := factory
+	factory = f
+	return prev
+}
+
+// NewClient returns a client for the cluster selected by opts and the
+// namespace to use.
+func NewClient(opts Options) (kubernetes.Interface, string, error) {
+	factoryMu.Lock()
+	f := factory
+	factoryMu.Unlock()
+	return f(opts)
+}
+
+// SetDynamicFactory replaces the DynamicFactory used by NewDynamicClient and
+// returns the previous one, e.g. to substitute the client from
+// k8s.io/client-go/dynamic/fake.
+func SetDynamicFactory(f DynamicFactory) DynamicFactory {
+	factoryMu.Lock()
+	defer factoryMu.Unlock()
+	prev := dynamicFactory
+	dynamicFactory = f
+	return prev
+}
+
+// NewDynamicClient returns a dynamic client for the cluster selected by opts
+// and the namespace to use.
+func NewDynamicClient(opts Options) (dynamic.Interface, string, error) {
+	factoryMu.Lock()
+	f := dynamicFactory
+	factoryMu.Unlock()
+	return f(opts)
+}
+
+// newClientset loads the kubeconfig and creates a clientset from it.
+func newClientset(opts Options) (kubernetes.Interface, string, error) {
+	restConfig, namespace, err := loadConfig(opts)
+	if err != nil {
+		return nil, "", err
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	return client, namespace, nil
+}
+
+// newDynamicClient loads the kubeconfig and creates a dynamic client from it.
+func newDynamicClient(opts Options) (dynamic.Interface, string, error) {
+	restConfig, namespace, err := loadConfig(opts)
+	if err != nil {
+		return nil, "", err
+	}
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	return client, namespace, nil
+}
+
+// loadConfig resolves opts against the kubeconfig into a REST config and
+// the namespace to use.
+func loadConfig(opts Options) (*rest.Config, string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = opts.Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: opts.Context}
+	overrides.Context.Namespace = opts.Namespace
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	restConfig.Timeout = Timeout
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	return restConfig, namespace, nil
+}
+
+// Ping checks that the cluster is reachable.
+func Ping(client kubernetes.Interface) error {
+	if _, err := client.Discovery().ServerVersion(); err != nil {
+		return fmt.Errorf("cluster is not reachable: %w", err)
+	}
+	return nil
+}
+
+// GetConfigMap returns the named ConfigMap, or nil if it does not exist.
+func GetConfigMap(ctx context.Context, client kubernetes.Interface, namespace, name string) (*corev1.ConfigMap, error) {
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ConfigMap %s/%s: %w", namespace, name, err)
+	}
+	return cm, nil
+}
+
+// ApplyConfigMap creates cm, or sets the keys of cm.Data in the existing
+// ConfigMap of the same name, keeping its other keys, labels and other
+// metadata.
+func ApplyConfigMap(ctx context.Context, client kubernetes.Interface, cm *corev1.ConfigMap) error {
+	configMaps := client.CoreV1().ConfigMaps(cm.Namespace)
+	existing, err := GetConfigMap(ctx, client, cm.Namespace, cm.Name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		if _, err := configMaps.Create(ctx, cm, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create ConfigMap %s/%s: %w", cm.Namespace, cm.Name, err)
+		}
+		return nil
+	}
+	if existing.Data == nil {
+		existing.Data = map[string]string{}
+	}
+	for key, value := range cm.Data {
+		existing.Data[key] = value
+	}
+	if _, err := configMaps.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update ConfigMap %s/%s: %w", cm.Namespace, cm.Name, err)
+	}
+	return nil
+}
+
+// RemoveConfigMapKey deletes key from the data of the named ConfigMap; a
+// missing ConfigMap or key is not an error.
+func RemoveConfigMapKey(ctx context.Context, client kubernetes.Interface, namespace, name, key string) error {
+	existing, err := GetConfigMap(ctx, client, namespace, name)
+	if err != nil || existing == nil {
+		return err
+	}
+	if _, ok := existing.Data[key]; !ok {
+		return nil
+	}
+	delete(existing.Data, key)
+	if _, err := client.CoreV1().ConfigMaps(namespace).Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update ConfigMap %s/%s: %w", namespace, name, err)
+	}
+	return nil
+}
+
+// DeleteConfigMap deletes the named ConfigMap; a missing one is not an error.
+func DeleteConfigMap(ctx context.Context, client kubernetes.Interface, namespace, name string) error {
+	err := client.CoreV1().ConfigMaps(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete ConfigMap %s/%s: %w", namespace, name, err)
+	}
+	return nil
+}
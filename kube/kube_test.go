@@ -0,0 +1,79 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestApplyConfigMapMergesData(t *testing.T) {
+	existing := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "trust", Labels: map[string]string{"team": "platform"}},
+		Data:       map[string]string{"other.crt": "other", "ca.crt": "old"},
+		BinaryData: map[string][]byte{"truststore.jks": []byte("jks")},
+	}
+	client := fake.NewSimpleClientset(existing)
+	ctx := context.Background()
+
+	err := ApplyConfigMap(ctx, client, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "trust"},
+		Data:       map[string]string{"ca.crt": "new"},
+	})
+	if err != nil {
+		t.Fatalf("ApplyConfigMap: %v", err)
+	}
+	cm, err := GetConfigMap(ctx, client, "default", "trust")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cm.Data["ca.crt"] != "new" || cm.Data["other.crt"] != "other" {
+		t.Fatalf("data after apply: %v", cm.Data)
+	}
+	if string(cm.BinaryData["truststore.jks"]) != "jks" || cm.Labels["team"] != "platform" {
+		t.Fatalf("binary data or labels changed: %v, %v", cm.BinaryData, cm.Labels)
+	}
+
+	if err := RemoveConfigMapKey(ctx, client, "default", "trust", "ca.crt"); err != nil {
+		t.Fatalf("RemoveConfigMapKey: %v", err)
+	}
+	cm, _ = GetConfigMap(ctx, client, "default", "trust")
+	if _, ok := cm.Data["ca.crt"]; ok || cm.Data["other.crt"] != "other" {
+		t.Fatalf("data after removing ca.crt: %v", cm.Data)
+	}
+}
+
+func TestConfigMapCreateAndDelete(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx := context.Background()
+
+	if cm, err := GetConfigMap(ctx, client, "default", "trust"); cm != nil || err != nil {
+		t.Fatalf("GetConfigMap of a missing ConfigMap: %v, %v", cm, err)
+	}
+	if err := RemoveConfigMapKey(ctx, client, "default", "trust", "ca.crt"); err != nil {
+		t.Fatalf("RemoveConfigMapKey of a missing ConfigMap: %v", err)
+	}
+
+	err := ApplyConfigMap(ctx, client, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "trust"},
+		Data:       map[string]string{"ca.crt": "root"},
+	})
+	if err != nil {
+		t.Fatalf("ApplyConfigMap: %v", err)
+	}
+	if cm, _ := GetConfigMap(ctx, client, "default", "trust"); cm == nil || cm.Data["ca.crt"] != "root" {
+		t.Fatalf("ConfigMap not created: %v", cm)
+	}
+
+	if err := DeleteConfigMap(ctx, client, "default", "trust"); err != nil {
+		t.Fatalf("DeleteConfigMap: %v", err)
+	}
+	if cm, _ := GetConfigMap(ctx, client, "default", "trust"); cm != nil {
+		t.Fatal("ConfigMap left after delete")
+	}
+	if err := DeleteConfigMap(ctx, client, "default", "trust"); err != nil {
+		t.Fatalf("DeleteConfigMap of a missing ConfigMap: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package kube
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+// ManagedByLabel marks the objects apprecert creates.
+const ManagedByLabel = "app.kubernetes.io/managed-by"
+
+// TLSSecret returns a kubernetes.io/tls Secret holding a certificate and
+// its key, with the CA that issued it as ca.crt. An empty namespace is left
+// out, for the namespace to be chosen when the Secret is applied.
+func TLSSecret(namespace, name string, certPEM, keyPEM, caPEM []byte) *unstructured.Unstructured {
+	secret := newObject("v1", "Secret", namespace, name)
+	secret.Object["type"] = "kubernetes.io/tls"
+	secret.Object["data"] = map[string]interface{}{
+		"tls.crt": base64.StdEncoding.EncodeToString(certPEM),
+		"tls.key": base64.StdEncoding.EncodeToString(keyPEM),
+		"ca.crt":  base64.StdEncoding.EncodeToString(caPEM),
+	}
+	return secret
+}
+
+// newObject returns an object of the given kind labelled as managed by
+// apprecert.
+func newObject(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetLabels(map[string]string{ManagedByLabel: "apprecert"})
+	return obj
+}
+
+// resource returns the client for the kind of obj, in its namespace if it
+// has one.
+func resource(client dynamic.Interface, obj *unstructured.Unstructured) dynamic.ResourceInterface {
+	gvr, _ := meta.UnsafeGuessKindToResource(obj.GroupVersionKind())
+	if ns := obj.GetNamespace(); ns != "" {
+		return client.Resource(gvr).Namespace(ns)
+	}
+	return client.Resource(gvr)
+}
+
+// describe names obj in messages, e.g. "Secret cert-manager/apprecert-ca".
+func describe(obj *unstructured.Unstructured) string {
+	if ns := obj.GetNamespace(); ns != "" {
+		return fmt.Sprintf("%s %s/%s", obj.GetKind(), ns, obj.GetName())
+	}
+	return fmt.Sprintf("%s %s", obj.GetKind(), obj.GetName())
+}
+
+// ApplyObject creates obj, or replaces everything but the metadata of the
+// existing object of the same name if apprecert created it. An object
+// created by someone else is left alone and reported as an error.
+func ApplyObject(ctx context.Context, client dynamic.Interface, obj *unstructured.Unstructured) error {
+	objects := resource(client, obj)
+	existing, err := objects.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err := objects.Create(ctx, obj, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create %s: %w", describe(obj), err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", describe(obj), err)
+	}
+	if existing.GetLabels()[ManagedByLabel] != "apprecert" {
+		return fmt.Errorf("%s exists and was not created by apprecert, not replacing it", describe(obj))
+	}
+
+	for field, value := range obj.Object {
+		if field != "metadata" {
+			existing.Object[field] = value
+		}
+	}
+	if _, err := objects.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update %s: %w", describe(obj), err)
+	}
+	return nil
+}
+
+// DeleteObject deletes the object named like obj, if apprecert created it.
+// A missing object is not an error.
+func DeleteObject(ctx context.Context, client dynamic.Interface, obj *unstructured.Unstructured) error {
+	objects := resource(client, obj)
+	existing, err := objects.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", describe(obj), err)
+	}
+	if existing.GetLabels()[ManagedByLabel] != "apprecert" {
+		return fmt.Errorf("%s was not created by apprecert, not deleting it", describe(obj))
+	}
+	err = objects.Delete(ctx, obj.GetName(), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s: %w", describe(obj), err)
+	}
+	return nil
+}
+
+// WriteYAML writes objs to w as a multi-document YAML stream.
+func WriteYAML(w io.Writer, objs []*unstructured.Unstructured) error {
+	for i, obj := range objs {
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", describe(obj), err)
+		}
+		if i > 0 {
+			if _, err := io.WriteString(w, "---\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
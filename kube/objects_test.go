@@ -0,0 +1,118 @@
+package kube
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+// getObject returns the object named like obj, or nil if it does not exist.
+func getObject(t *testing.T, client *fake.FakeDynamicClient, obj *unstructured.Unstructured) *unstructured.Unstructured {
+	t.Helper()
+	got, err := resource(client, obj).Get(context.Background(), obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+// foreignSecret returns a Secret named like apprecert's that someone else
+// created.
+func foreignSecret() *unstructured.Unstructured {
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	secret.SetAPIVersion("v1")
+	secret.SetKind("Secret")
+	secret.SetNamespace("cert-manager")
+	secret.SetName("apprecert-ca")
+	secret.SetLabels(map[string]string{"team": "platform"})
+	secret.Object["data"] = map[string]interface{}{"token": base64.StdEncoding.EncodeToString([]byte("s3cret"))}
+	return secret
+}
+
+func TestApplyAndDeleteObjects(t *testing.T) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	ctx := context.Background()
+	export := CertManager{Name: "apprecert-ca", Namespace: "cert-manager", CertPEM: []byte("cert"), KeyPEM: []byte("key"), RootPEM: []byte("root")}
+
+	for _, obj := range export.Objects() {
+		if err := ApplyObject(ctx, client, obj); err != nil {
+			t.Fatalf("ApplyObject: %v", err)
+		}
+		got := getObject(t, client, obj)
+		if got == nil || got.GetLabels()[ManagedByLabel] != "apprecert" {
+			t.Fatalf("%s not created with the managed-by label: %v", describe(obj), got)
+		}
+	}
+
+	// Applying again updates the objects apprecert created
+	export.RootPEM = []byte("new root")
+	secret := export.Objects()[0]
+	if err := ApplyObject(ctx, client, secret); err != nil {
+		t.Fatalf("ApplyObject: %v", err)
+	}
+	data := getObject(t, client, secret).Object["data"].(map[string]interface{})
+	if data["ca.crt"] != base64.StdEncoding.EncodeToString([]byte("new root")) {
+		t.Fatalf("Secret data after update: %v", data)
+	}
+
+	for _, obj := range export.Objects() {
+		if err := DeleteObject(ctx, client, obj); err != nil {
+			t.Fatalf("DeleteObject: %v", err)
+		}
+		if getObject(t, client, obj) != nil {
+			t.Fatalf("%s left after delete", describe(obj))
+		}
+	}
+}
+
+func TestApplyObjectLeavesForeignObject(t *testing.T) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), foreignSecret())
+	ctx := context.Background()
+	secret := TLSSecret("cert-manager", "apprecert-ca", []byte("cert"), []byte("key"), []byte("root"))
+
+	err := ApplyObject(ctx, client, secret)
+	if err == nil || !strings.Contains(err.Error(), "not created by apprecert") {
+		t.Fatalf("ApplyObject: got %v, want a refusal", err)
+	}
+	got := getObject(t, client, secret)
+	if _, ok := got.GetLabels()[ManagedByLabel]; ok {
+		t.Fatal("foreign Secret labelled as managed by apprecert")
+	}
+	if data := got.Object["data"].(map[string]interface{}); len(data) != 1 || data["token"] == nil {
+		t.Fatalf("foreign Secret data changed: %v", data)
+	}
+
+	if err := DeleteObject(ctx, client, secret); err == nil {
+		t.Fatal("DeleteObject deleted a foreign Secret")
+	}
+	if getObject(t, client, secret) == nil {
+		t.Fatal("foreign Secret deleted")
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	export := CertManager{Name: "apprecert-ca", Namespace: "cert-manager", CertPEM: []byte("cert"), KeyPEM: []byte("key"), RootPEM: []byte("root")}
+	var buf strings.Builder
+	if err := WriteYAML(&buf, export.Objects()); err != nil {
+		t.Fatalf("WriteYAML: %v", err)
+	}
+	docs := strings.Split(buf.String(), "---\n")
+	if len(docs) != 3 {
+		t.Fatalf("%d documents, want 3:\n%s", len(docs), buf.String())
+	}
+	for i, kind := range []string{"Secret", "ClusterIssuer", "Bundle"} {
+		if !strings.Contains(docs[i], "kind: "+kind+"\n") || !strings.Contains(docs[i], ManagedByLabel+": apprecert") {
+			t.Fatalf("document %d is not a labelled %s:\n%s", i, kind, docs[i])
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package pkcs8
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"testing"
+)
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	der := testKey(t)
+	encrypted, err := Encrypt(der, []byte("s3cret"))
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if bytes.Contains(encrypted, der) {
+		t.Fatal("encrypted key contains the plain key")
+	}
+
+	decrypted, err := Decrypt(encrypted, []byte("s3cret"))
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if !bytes.Equal(decrypted, der) {
+		t.Fatal("decrypted key differs from the original")
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(decrypted); err != nil {
+		t.Fatalf("decrypted key does not parse: %v", err)
+	}
+}
+
+func TestEncryptUsesFreshSalt(t *testing.T) {
+	der := testKey(t)
+	a, err := Encrypt(der, []byte("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Encrypt(der, []byte("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(a, b) {
+		t.Fatal("two encryptions of the same key are identical")
+	}
+}
+
+func TestDecryptWrongPassphrase(t *testing.T) {
+	encrypted, err := Encrypt(testKey(t), []byte("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(encrypted, []byte("wrong")); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Fatalf("Decrypt with the wrong passphrase: got %v, want ErrIncorrectPassphrase", err)
+	}
+}
+
+func TestDecryptGarbage(t *testing.T) {
+	if _, err := Decrypt([]byte("not a key"), []byte("s3cret")); err == nil {
+		t.Fatal("Decrypt accepted garbage")
+	}
+}
@@ -0,0 +1,64 @@
+package truststore
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/appremon/apprecert/utils"
+)
+
+// clearBlock removes the managed block from the file at path, deleting the
+// file if nothing else is left in it. A missing file or block is not an
+// error. It reports whether the file changed.
+func clearBlock(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	updated, ok := utils.RemoveBlock(data)
+	if !ok {
+		return false, nil
+	}
+	if len(bytes.TrimSpace(updated)) == 0 {
+		return true, CurrentRunner().Remove(path, needsRoot(path))
+	}
+	return updateFile(path, data, updated, 0644)
+}
+
+// updateFile writes updated to path if it differs from data, keeping the
+// permissions of an existing file and writing as root if the user cannot.
+func updateFile(path string, data, updated []byte, perm os.FileMode) (bool, error) {
+	if bytes.Equal(data, updated) {
+		return false, nil
+	}
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return true, CurrentRunner().WriteFile(path, updated, perm, needsRoot(path))
+}
+
+// ensureDir creates dir and its parents if it does not exist yet,
+// journaling their removal.
+func ensureDir(dir string) error {
+	var missing []string
+	for d := dir; !utils.PathExists(d); d = filepath.Dir(d) {
+		missing = append(missing, d)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if err := CurrentRunner().Apply("create "+dir, func() error { return os.MkdirAll(dir, 0755) }); err != nil {
+		return err
+	}
+	// Parents first, so rolling back removes the deepest directory first
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := recordDir(missing[i], false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
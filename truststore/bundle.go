@@ -0,0 +1,57 @@
+package truststore
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/appremon/apprecert/config"
+	"github.com/appremon/apprecert/utils"
+)
+
+// systemBundleFiles are the PEM bundles of the platform roots, as searched
+// by crypto/x509.
+var systemBundleFiles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",                // Debian, Ubuntu, Arch, Alpine
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", // Fedora, RHEL 7+
+	"/etc/pki/tls/certs/ca-bundle.crt",                  // RHEL 6
+	"/etc/ssl/ca-bundle.pem",                            // openSUSE
+	"/etc/ssl/cert.pem",                                 // macOS, Alpine
+}
+
+// systemRoots returns the platform roots as PEM. Platforms without a bundle
+// file, such as Windows, fall back to the first certifi bundle found.
+func systemRoots() ([]byte, error) {
+	for _, path := range systemBundleFiles {
+		if data, err := os.ReadFile(hostPath(path)); err == nil {
+			return data, nil
+		}
+	}
+	for _, path := range FindCertifiBundles() {
+		if data, err := os.ReadFile(path); err == nil {
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("no system CA bundle found")
+}
+
+// writeCombinedBundle writes CAROOT/name holding the roots in base followed
+// by the root CA in a managed block, for tools that take a single CA file
+// instead of adding to their defaults. It returns the path of the bundle.
+func writeCombinedBundle(cfg *config.Config, name string, base []byte) (string, error) {
+	certBytes, err := os.ReadFile(filepath.Join(cfg.CAROOT, "rootCA.pem"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read certificate: %w", err)
+	}
+	base, _ = utils.RemoveBlock(base)
+	path := filepath.Join(cfg.CAROOT, name)
+	bundle := utils.SetBlock(base, string(certBytes))
+	if data, err := os.ReadFile(path); err == nil && bytes.Equal(data, bundle) {
+		return path, nil
+	}
+	if err := CurrentRunner().WriteFile(path, bundle, 0644, false); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return path, nil
+}
@@ -0,0 +1,95 @@
+package truststore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"os"
+	"strings"
+
+	"github.com/appremon/apprecert/config"
+)
+
+// Report is the trust status of the root CA across the selected stores.
+type Report struct {
+	Fingerprint string   `json:"fingerprint"` // SHA-256 of the root certificate
+	Subject     string   `json:"subject"`
+	Statuses    []Status `json:"stores"`
+}
+
+// Check inspects the selected stores for the root CA. Undetected stores and
+// stores whose inspection fails are reported with StateUnavailable and
+// StateUnknown rather than aborting the whole check.
+func Check(cfg *config.Config, sel Selection) (*Report, error) {
+	if err := sel.validate(); err != nil {
+		return nil, err
+	}
+	caCert, err := cfg.LoadRootCert()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Fingerprint: Fingerprint(caCert), Subject: caCert.Subject.String()}
+	for _, s := range Stores() {
+		name := s.Name()
+		if !sel.includes(name) {
+			continue
+		}
+		if err := s.Detect(cfg); err != nil {
+			report.Statuses = append(report.Statuses, Status{Store: name, State: StateUnavailable, Detail: err.Error()})
+			continue
+		}
+		statuses, err := s.Check(cfg)
+		if err != nil {
+			report.Statuses = append(report.Statuses, Status{Store: name, State: StateUnknown, Detail: err.Error()})
+			continue
+		}
+		report.Statuses = append(report.Statuses, statuses...)
+	}
+	return report, nil
+}
+
+// Fingerprint returns the hex encoded SHA-256 fingerprint of a certificate.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// matchPEM compares the certificates in PEM data against caCert. It reports
+// StatePresent if caCert is among them, StateStale if only a different
+// certificate with the same subject is, e.g. from a CA that was recreated,
+// and StateAbsent otherwise.
+func matchPEM(data []byte, caCert *x509.Certificate) State {
+	state := StateAbsent
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return state
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if bytes.Equal(block.Bytes, caCert.Raw) {
+			return StatePresent
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil &&
+			bytes.Equal(cert.RawSubject, caCert.RawSubject) {
+			state = StateStale
+		}
+	}
+}
+
+// matchFile is matchPEM on the contents of path; a missing file is absent.
+func matchFile(path string, caCert *x509.Certificate) (State, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return StateAbsent, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return matchPEM(data, caCert), nil
+}
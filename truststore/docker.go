@@ -1,44 +1,257 @@
 package truststore
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 
 	"github.com/appremon/apprecert/config"
+	"github.com/appremon/apprecert/utils"
 )
 
-func RemoveDockerTrust(cfg *config.Config) error {
-	destPath := "/usr/local/share/ca-certificates/rootCA.crt"
-	if err := os.Remove(destPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove Docker trust certificate: %w", err)
+// containerRuntime is a container engine that reads per-registry CA files
+// from a certs.d directory.
+type containerRuntime struct {
+	name     string   // the runtime, as shown in notes and status
+	certsDir string   // the system certs.d directory, holding a directory per registry
+	commands []string // the commands whose presence marks the runtime as installed
+	hosts    bool     // the runtime needs a hosts.toml pointing at the CA file
+}
+
+// containerRuntimes lists the runtimes the docker store configures. Podman,
+// Buildah, Skopeo and CRI-O share /etc/containers.
+var containerRuntimes = []containerRuntime{
+	{name: "docker", certsDir: "/etc/docker/certs.d", commands: []string{"docker", "dockerd"}},
+	{name: "containers", certsDir: "/etc/containers/certs.d", commands: []string{"podman", "buildah", "skopeo", "crio"}},
+	{name: "containerd", certsDir: "/etc/containerd/certs.d", commands: []string{"containerd"}, hosts: true},
+}
+
+// installed reports whether the runtime is on PATH or has a configuration
+// directory.
+func (rt containerRuntime) installed() bool {
+	for _, name := range rt.commands {
+		if lookPath(name) == nil {
+			return true
+		}
 	}
+	return utils.PathExists(hostPath(path.Dir(rt.certsDir)))
+}
 
-	// Update CA certificates in Docker
-	cmd := exec.Command("sudo", "update-ca-certificates")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to update Docker CA certificates: %w", err)
+// caFile returns the system path of the CA file for registry.
+func (rt containerRuntime) caFile(registry string) string {
+	return path.Join(rt.certsDir, registry, "ca.crt")
+}
+
+// hostsFile returns the system path of containerd's hosts.toml for registry.
+func (rt containerRuntime) hostsFile(registry string) string {
+	return path.Join(rt.certsDir, registry, "hosts.toml")
+}
+
+// registryDir normalizes a registry given as host[:port], optionally with
+// an https:// prefix, to the name of its certs.d directory.
+func registryDir(registry string) (string, error) {
+	name := strings.TrimSuffix(strings.TrimPrefix(registry, "https://"), "/")
+	if name == "" || strings.ContainsAny(name, "/\\ ") || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid registry %q, expected host or host:port", registry)
 	}
+	return name, nil
+}
 
-	return nil
+// containerdHosts returns the hosts.toml body making containerd verify
+// registry with caFile.
+func containerdHosts(registry, caFile string) string {
+	server := strconv.Quote("https://" + registry)
+	return fmt.Sprintf("server = %s\n\n[host.%s]\n  ca = %s\n", server, server, strconv.Quote(caFile))
 }
-// UpdateDockerTrust copies the certificate to Docker images and updates trust.
+
+// UpdateDockerTrust makes the container runtimes trust the root CA for the
+// registries in cfg.ContainerRegistries: Docker through
+// /etc/docker/certs.d/<registry>/ca.crt, Podman and the other
+// containers/image tools through /etc/containers/certs.d, and containerd
+// through /etc/containerd/certs.d with a hosts.toml. The CA is a managed
+// block, so CA files the user already has are kept.
 func UpdateDockerTrust(cfg *config.Config) error {
-	certPath := filepath.Join(cfg.CAROOT, "rootCA.pem")
-	destPath := "/usr/local/share/ca-certificates/rootCA.crt"
+	if len(cfg.ContainerRegistries) == 0 {
+		return fmt.Errorf("no registries configured; pass -registries")
+	}
+	certBytes, err := os.ReadFile(filepath.Join(cfg.CAROOT, "rootCA.pem"))
+	if err != nil {
+		return fmt.Errorf("failed to read certificate: %w", err)
+	}
 
-	// Copy certificate to the appropriate directory
-	cmd := exec.Command("sudo", "cp", certPath, destPath)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to copy certificate to Docker: %w", err)
+	for _, rt := range containerRuntimes {
+		if !rt.installed() {
+			continue
+		}
+		for _, registry := range cfg.ContainerRegistries {
+			registry, err := registryDir(registry)
+			if err != nil {
+				return err
+			}
+			if err := setSystemBlock(rt.caFile(registry), string(certBytes)); err != nil {
+				return fmt.Errorf("failed to add certificate for %s: %w", rt.name, err)
+			}
+			if !rt.hosts {
+				continue
+			}
+			hostsFile := rt.hostsFile(registry)
+			data, err := os.ReadFile(hostPath(hostsFile))
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to read %s: %w", hostsFile, err)
+			}
+			if _, _, ok := utils.FindBlock(data); len(data) > 0 && !ok {
+				addNote("%s exists, add ca = %q to it", hostsFile, rt.caFile(registry))
+				continue
+			}
+			if err := setSystemBlock(hostsFile, containerdHosts(registry, rt.caFile(registry))); err != nil {
+				return fmt.Errorf("failed to configure containerd: %w", err)
+			}
+		}
+		if rt.hosts && !containerdUsesCertsDir() {
+			addNote("set config_path = %q in containerd's CRI registry config and restart it", rt.certsDir)
+		}
 	}
+	return nil
+}
+
+// containerdUsesCertsDir reports whether containerd's config.toml points
+// the CRI plugin at a hosts directory, without which hosts.toml is ignored.
+func containerdUsesCertsDir() bool {
+	data, err := os.ReadFile(hostPath("/etc/containerd/config.toml"))
+	return err == nil && bytes.Contains(data, []byte("config_path"))
+}
 
-	// Update CA certificates in Docker
-	cmd = exec.Command("sudo", "update-ca-certificates")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to update CA certificates: %w", err)
+// setSystemBlock sets the managed block of a root-owned file to body,
+// creating the file and its directories as needed.
+func setSystemBlock(file, body string) error {
+	file = hostPath(file)
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	updated := utils.SetBlock(data, body)
+	if bytes.Equal(data, updated) {
+		return nil
+	}
+	if err := ensureSystemDir(filepath.Dir(file)); err != nil {
+		return err
 	}
+	return CurrentRunner().WriteFile(file, updated, 0644, true)
+}
 
+// ensureSystemDir creates dir and its missing parents as root, journaling
+// their removal.
+func ensureSystemDir(dir string) error {
+	var missing []string
+	for d := dir; !utils.PathExists(d); d = filepath.Dir(d) {
+		missing = append(missing, d)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if err := runCmd(true, "mkdir", "-p", dir); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	// Parents first, so rolling back removes the deepest directory first
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := recordDir(missing[i], true); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// RemoveDockerTrust removes the root CA from the certs.d directories of all
+// registries, including ones no longer in cfg.ContainerRegistries, and
+// deletes the files left empty. Only the directories of the registries in
+// cfg.ContainerRegistries are deleted once empty; others may belong to the
+// user.
+func RemoveDockerTrust(cfg *config.Config) error {
+	var errs []error
+	for _, rt := range containerRuntimes {
+		dirs, _ := filepath.Glob(filepath.Join(hostPath(rt.certsDir), "*"))
+		for _, dir := range dirs {
+			for _, name := range []string{"ca.crt", "hosts.toml"} {
+				if _, err := clearBlock(filepath.Join(dir, name)); err != nil {
+					errs = append(errs, fmt.Errorf("failed to update %s: %w", filepath.Join(dir, name), err))
+				}
+			}
+		}
+		for _, registry := range cfg.ContainerRegistries {
+			registry, err := registryDir(registry)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			dir := hostPath(path.Join(rt.certsDir, registry))
+			if entries, err := os.ReadDir(dir); err == nil && len(entries) == 0 {
+				if err := runCmd(true, "rmdir", dir); err != nil {
+					errs = append(errs, fmt.Errorf("failed to remove %s: %w", dir, err))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// dockerStore makes Docker, Podman and containerd on Linux hosts trust the
+// root CA for selected registries.
+type dockerStore struct{}
+
+func (dockerStore) Name() string { return "docker" }
+
+func (dockerStore) Detect(cfg *config.Config) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("only supported on Linux")
+	}
+	for _, rt := range containerRuntimes {
+		if rt.installed() {
+			if len(cfg.ContainerRegistries) == 0 {
+				return fmt.Errorf("no registries configured; pass -registries")
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no container runtime found")
+}
+
+func (dockerStore) Install(cfg *config.Config) error { return UpdateDockerTrust(cfg) }
+
+func (dockerStore) Uninstall(cfg *config.Config) error { return RemoveDockerTrust(cfg) }
+
+func (dockerStore) Check(cfg *config.Config) ([]Status, error) {
+	caCert, err := cfg.LoadRootCert()
+	if err != nil {
+		return nil, err
+	}
+	var statuses []Status
+	for _, rt := range containerRuntimes {
+		if !rt.installed() {
+			continue
+		}
+		for _, registry := range cfg.ContainerRegistries {
+			registry, err := registryDir(registry)
+			if err != nil {
+				return nil, err
+			}
+			status := Status{Store: "docker", Location: rt.caFile(registry), Detail: rt.name}
+			if status.State, err = matchFile(hostPath(status.Location), caCert); err != nil {
+				return nil, err
+			}
+			if rt.hosts && status.State == StatePresent {
+				data, _ := os.ReadFile(hostPath(rt.hostsFile(registry)))
+				if !bytes.Contains(data, []byte(strconv.Quote(rt.caFile(registry)))) {
+					status.Detail += ", hosts.toml does not use ca.crt"
+				}
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses, nil
+}
@@ -0,0 +1,132 @@
+package truststore_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appremon/apprecert/truststore"
+)
+
+// registryDirs creates the Docker certs.d directories of registries, since
+// the runner does not run mkdir, and returns the first one.
+func (e *env) registryDirs(t *testing.T, registries ...string) string {
+	t.Helper()
+	for _, registry := range registries {
+		if err := os.MkdirAll(e.hostFile("/etc/docker/certs.d/"+registry), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return e.hostFile("/etc/docker/certs.d/" + registries[0])
+}
+
+func TestDockerInstallUninstall(t *testing.T) {
+	e := newEnv(t)
+	e.r.Provide("docker")
+	e.cfg.ContainerRegistries = []string{"registry.test:5000"}
+	dir := e.registryDirs(t, "registry.test:5000")
+	caFile := filepath.Join(dir, "ca.crt")
+
+	e.install(t, "docker")
+	if !strings.Contains(readFile(t, caFile), string(rootPEM(t, e.cfg))) {
+		t.Fatal("ca.crt does not hold the root CA")
+	}
+	if state := e.state(t, "docker"); state != truststore.StatePresent {
+		t.Fatalf("state %s after install, want present", state)
+	}
+	e.reinstall(t, "docker")
+
+	e.r.Reset()
+	e.uninstall(t, "docker")
+	if _, err := os.Stat(caFile); !os.IsNotExist(err) {
+		t.Fatalf("ca.crt left after uninstall:\n%s", readFile(t, caFile))
+	}
+	want := "rmdir " + dir
+	if cmds := e.r.Commands(); len(cmds) != 1 || cmds[0] != want {
+		t.Fatalf("commands %q, want [%s]", cmds, want)
+	}
+}
+
+func TestDockerKeepsUserCA(t *testing.T) {
+	e := newEnv(t)
+	e.r.Provide("docker")
+	e.cfg.ContainerRegistries = []string{"registry.test"}
+	caFile := filepath.Join(e.registryDirs(t, "registry.test"), "ca.crt")
+	corp := "# corporate CA\n"
+	writeFile(t, caFile, []byte(corp))
+
+	e.install(t, "docker")
+	if data := readFile(t, caFile); !strings.HasPrefix(data, corp) || !strings.Contains(data, string(rootPEM(t, e.cfg))) {
+		t.Fatalf("ca.crt after install:\n%s", data)
+	}
+	e.reinstall(t, "docker")
+
+	e.r.Reset()
+	e.uninstall(t, "docker")
+	if data := readFile(t, caFile); data != corp {
+		t.Fatalf("ca.crt after uninstall:\n%s", data)
+	}
+	if hasCommand(e.r, "rmdir") {
+		t.Fatalf("uninstall removed a directory still in use: %q", e.r.Commands())
+	}
+}
+
+func TestDockerUninstallKeepsOtherRegistryDirs(t *testing.T) {
+	e := newEnv(t)
+	e.r.Provide("docker")
+	e.cfg.ContainerRegistries = []string{"registry.test"}
+	dir := e.registryDirs(t, "registry.test", "other.test")
+
+	e.install(t, "docker")
+	e.r.Reset()
+	e.uninstall(t, "docker")
+	want := "rmdir " + dir
+	if cmds := e.r.Commands(); len(cmds) != 1 || cmds[0] != want {
+		t.Fatalf("commands %q, want only [%s]", cmds, want)
+	}
+}
+
+func TestDockerNoRegistries(t *testing.T) {
+	e := newEnv(t)
+	e.r.Provide("docker")
+	if _, err := truststore.Install(e.cfg, truststore.Selection{Only: []string{"docker"}}); err == nil || !strings.Contains(err.Error(), "-registries") {
+		t.Fatalf("Install: got %v, want a hint at -registries", err)
+	}
+}
+
+func TestDockerRollbackRemovesCreatedDirs(t *testing.T) {
+	e := newEnv(t)
+	e.r.Provide("docker")
+	e.cfg.ContainerRegistries = []string{"registry.test"}
+	if err := os.MkdirAll(e.hostFile("/etc/docker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The runner does not run mkdir, so writing ca.crt fails and the
+	// install is rolled back
+	results, err := truststore.Install(e.cfg, truststore.Selection{Only: []string{"docker"}})
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if results.Err() == nil {
+		t.Fatal("Install succeeded without its certs.d directory")
+	}
+	certsDir := e.hostFile("/etc/docker/certs.d")
+	want := []string{
+		"remove " + filepath.Join(certsDir, "registry.test") + " (sudo)",
+		"remove " + certsDir + " (sudo)",
+	}
+	var removed []string
+	for _, c := range e.r.Calls() {
+		if c.Op == "remove" && c.Args[0] != filepath.Join(certsDir, "registry.test", "ca.crt") {
+			removed = append(removed, c.String())
+		}
+	}
+	if strings.Join(removed, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("rollback removed %q, want %q", removed, want)
+	}
+	if hasCommand(e.r, "rmdir") {
+		t.Fatalf("rollback ran rmdir instead of removing the journaled directories: %q", e.r.Commands())
+	}
+}
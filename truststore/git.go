@@ -1,34 +1,194 @@
 package truststore
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
 
 	"github.com/appremon/apprecert/config"
+	"github.com/appremon/apprecert/utils"
 )
 
-// ConfigureGit sets Git to trust the generated certificate.
+// gitBundleFile is the bundle Git is pointed at. http.sslCAInfo replaces
+// the default roots, so it holds the system roots and the previously
+// configured bundle as well as the root CA.
+const gitBundleFile = "git-ca-bundle.pem"
+
+// gitCAInfoKey returns the config key of the CA file used for url, or the
+// global one if url is empty.
+func gitCAInfoKey(url string) string {
+	if url == "" {
+		return "http.sslCAInfo"
+	}
+	return "http." + url + ".sslCAInfo"
+}
+
+// gitConfigGet returns a global Git config value, or "" if it is unset.
+func gitConfigGet(key string) string {
+	// git exits non-zero when the key is unset
+	out, _ := query("git", "config", "--global", "--get", key)
+	return strings.TrimSpace(string(out))
+}
+
+// isGitBundle reports whether a configured CA file is one apprecert wrote:
+// the bundle, or rootCA.pem as set by older versions.
+func isGitBundle(cfg *config.Config, path string) bool {
+	return path == filepath.Join(cfg.CAROOT, gitBundleFile) || path == filepath.Join(cfg.CAROOT, "rootCA.pem")
+}
+
+// ConfigureGit points Git at a bundle of the system roots, the previously
+// configured http.sslCAInfo and the root CA. The previous value is kept in
+// config.json and restored by UnconfigureGit. With cfg.GitURLs, only
+// http.<url>.sslCAInfo of those URLs is set and the global value is left
+// alone.
 func ConfigureGit(cfg *config.Config) error {
 	certPath := filepath.Join(cfg.CAROOT, "rootCA.pem")
 	if _, err := os.Stat(certPath); os.IsNotExist(err) {
 		return fmt.Errorf("certificate not found at %s", certPath)
 	}
 
-	cmd := exec.Command("git", "config", "--global", "http.sslCAInfo", certPath)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to configure Git trust: %w", err)
+	current := gitConfigGet(gitCAInfoKey(""))
+	prev := current
+	if isGitBundle(cfg, current) {
+		prev = cfg.GitPreviousCAInfo
+	}
+	bundlePath, err := writeGitBundle(cfg, prev)
+	if err != nil {
+		return err
 	}
 
+	if len(cfg.GitURLs) == 0 {
+		if err := setGitCAInfo("", bundlePath, current); err != nil {
+			return err
+		}
+	}
+	for _, url := range cfg.GitURLs {
+		key := gitCAInfoKey(url)
+		current := gitConfigGet(key)
+		if current != "" && !isGitBundle(cfg, current) {
+			addNote("%s is already set to %s, left unchanged", key, current)
+			continue
+		}
+		if err := setGitCAInfo(url, bundlePath, current); err != nil {
+			return err
+		}
+	}
+
+	if len(cfg.GitURLs) == 0 && cfg.GitPreviousCAInfo != prev {
+		cfg.GitPreviousCAInfo = prev
+		return saveConfig(cfg, "remember the previous http.sslCAInfo in config.json")
+	}
 	return nil
 }
 
+// writeGitBundle writes the bundle from the system roots and the CA file
+// that was configured before apprecert's, if any.
+func writeGitBundle(cfg *config.Config, prev string) (string, error) {
+	roots, err := systemRoots()
+	if err != nil {
+		return "", err
+	}
+	if prev != "" {
+		data, err := os.ReadFile(prev)
+		if err != nil {
+			return "", fmt.Errorf("failed to read the configured http.sslCAInfo: %w", err)
+		}
+		if len(roots) > 0 && roots[len(roots)-1] != '\n' {
+			roots = append(roots, '\n')
+		}
+		roots = append(roots, data...)
+	}
+	return writeCombinedBundle(cfg, gitBundleFile, roots)
+}
+
+// setGitCAInfo sets the CA file for url to bundlePath, journaling how to
+// restore the current value.
+func setGitCAInfo(url, bundlePath, current string) error {
+	key := gitCAInfoKey(url)
+	if current == bundlePath {
+		return nil
+	}
+	if err := runCmd(false, "git", "config", "--global", key, bundlePath); err != nil {
+		return fmt.Errorf("failed to configure Git trust: %w", err)
+	}
+	if current != "" {
+		return recordUndo(false, "git", "config", "--global", key, current)
+	}
+	return recordUndo(false, "git", "config", "--global", "--unset", key)
+}
+
+// UnconfigureGit restores the http.sslCAInfo that ConfigureGit replaced,
+// unsets the per-URL values it set and removes the bundle. Values changed
+// since by the user are left alone.
 func UnconfigureGit(cfg *config.Config) error {
-	cmd := exec.Command("git", "config", "--global", "--unset", "http.sslCAInfo")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to unconfigure Git trust: %w", err)
+	var errs []error
+	if current := gitConfigGet(gitCAInfoKey("")); isGitBundle(cfg, current) {
+		args := []string{"config", "--global", "--unset", gitCAInfoKey("")}
+		if cfg.GitPreviousCAInfo != "" {
+			args = []string{"config", "--global", gitCAInfoKey(""), cfg.GitPreviousCAInfo}
+		}
+		if err := runCmd(false, "git", args...); err != nil {
+			errs = append(errs, fmt.Errorf("failed to unconfigure Git trust: %w", err))
+		}
+	}
+	for _, url := range cfg.GitURLs {
+		key := gitCAInfoKey(url)
+		if isGitBundle(cfg, gitConfigGet(key)) {
+			if err := runCmd(false, "git", "config", "--global", "--unset", key); err != nil {
+				errs = append(errs, fmt.Errorf("failed to unconfigure Git trust for %s: %w", url, err))
+			}
+		}
 	}
 
-	return nil
-}
\ No newline at end of file
+	bundlePath := filepath.Join(cfg.CAROOT, gitBundleFile)
+	if utils.PathExists(bundlePath) {
+		if err := CurrentRunner().Remove(bundlePath, false); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove %s: %w", bundlePath, err))
+		}
+	}
+	if len(errs) == 0 && cfg.GitPreviousCAInfo != "" {
+		cfg.GitPreviousCAInfo = ""
+		errs = append(errs, saveConfig(cfg, "forget the previous http.sslCAInfo in config.json"))
+	}
+	return errors.Join(errs...)
+}
+
+// gitStore points Git's global http.sslCAInfo, or that of cfg.GitURLs, at
+// a bundle including the root CA.
+type gitStore struct{}
+
+func (gitStore) Name() string { return "git" }
+
+func (gitStore) Detect(_ *config.Config) error { return lookPath("git") }
+
+func (gitStore) Install(cfg *config.Config) error { return ConfigureGit(cfg) }
+
+func (gitStore) Uninstall(cfg *config.Config) error { return UnconfigureGit(cfg) }
+
+func (gitStore) Check(cfg *config.Config) ([]Status, error) {
+	caCert, err := cfg.LoadRootCert()
+	if err != nil {
+		return nil, err
+	}
+	urls := cfg.GitURLs
+	if len(urls) == 0 {
+		urls = []string{""}
+	}
+	var statuses []Status
+	for _, url := range urls {
+		key := gitCAInfoKey(url)
+		status := Status{Store: "git", Location: key, State: StateAbsent}
+		if caInfo := gitConfigGet(key); caInfo != "" {
+			if url == "" {
+				status.Location = caInfo
+			}
+			if status.State, err = matchFile(caInfo, caCert); err != nil {
+				return nil, err
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
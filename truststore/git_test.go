@@ -0,0 +1,167 @@
+package truststore_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appremon/apprecert/truststore"
+	"github.com/appremon/apprecert/truststore/trusttest"
+)
+
+// gitConfig scripts the value git config --global --get returns for key.
+func (e *env) gitConfig(key, value string) {
+	e.r.On(trusttest.Response{Stdout: value + "\n"}, "git", "config", "--global", "--get", key)
+}
+
+func TestGitInstallUninstall(t *testing.T) {
+	e := newEnv(t)
+	roots := e.systemRoots(t)
+	e.r.Provide("git")
+	bundle := filepath.Join(e.cfg.CAROOT, "git-ca-bundle.pem")
+
+	e.install(t, "git")
+	want := "git config --global http.sslCAInfo " + bundle
+	if cmds := e.r.Commands(); len(cmds) != 1 || cmds[0] != want {
+		t.Fatalf("commands %q, want [%s]", cmds, want)
+	}
+	if data := readFile(t, bundle); !strings.HasPrefix(data, roots) || !strings.Contains(data, string(rootPEM(t, e.cfg))) {
+		t.Fatalf("bundle after install:\n%s", data)
+	}
+
+	e.gitConfig("http.sslCAInfo", bundle)
+	if state := e.state(t, "git"); state != truststore.StatePresent {
+		t.Fatalf("state %s after install, want present", state)
+	}
+	e.reinstall(t, "git")
+
+	e.r.Reset()
+	e.uninstall(t, "git")
+	want = "git config --global --unset http.sslCAInfo"
+	if cmds := e.r.Commands(); len(cmds) != 1 || cmds[0] != want {
+		t.Fatalf("commands %q, want [%s]", cmds, want)
+	}
+	if _, err := os.Stat(bundle); !os.IsNotExist(err) {
+		t.Fatal("bundle left after uninstall")
+	}
+}
+
+func TestGitRestoresPreviousCAInfo(t *testing.T) {
+	e := newEnv(t)
+	e.systemRoots(t)
+	e.r.Provide("git")
+	corp := filepath.Join(t.TempDir(), "corp.pem")
+	const corpRoots = "# corporate roots\n"
+	writeFile(t, corp, []byte(corpRoots))
+	e.gitConfig("http.sslCAInfo", corp)
+	bundle := filepath.Join(e.cfg.CAROOT, "git-ca-bundle.pem")
+
+	e.install(t, "git")
+	if !strings.Contains(readFile(t, bundle), corpRoots) {
+		t.Fatal("bundle does not include the previously configured roots")
+	}
+	if e.cfg.GitPreviousCAInfo != corp {
+		t.Fatalf("previous http.sslCAInfo %q, want %q", e.cfg.GitPreviousCAInfo, corp)
+	}
+	if !strings.Contains(readFile(t, filepath.Join(e.cfg.CAROOT, "config.json")), corp) {
+		t.Fatal("previous http.sslCAInfo not saved in config.json")
+	}
+
+	// Installing again keeps the original value, not our bundle
+	e.gitConfig("http.sslCAInfo", bundle)
+	e.reinstall(t, "git")
+	if e.cfg.GitPreviousCAInfo != corp {
+		t.Fatalf("previous http.sslCAInfo %q after reinstall, want %q", e.cfg.GitPreviousCAInfo, corp)
+	}
+
+	e.r.Reset()
+	e.uninstall(t, "git")
+	want := "git config --global http.sslCAInfo " + corp
+	if cmds := e.r.Commands(); len(cmds) != 1 || cmds[0] != want {
+		t.Fatalf("commands %q, want [%s]", cmds, want)
+	}
+	if e.cfg.GitPreviousCAInfo != "" {
+		t.Fatal("previous http.sslCAInfo not forgotten")
+	}
+}
+
+func TestGitUninstallLeavesUserValue(t *testing.T) {
+	e := newEnv(t)
+	e.r.Provide("git")
+	e.gitConfig("http.sslCAInfo", "/etc/corp.pem")
+
+	e.uninstall(t, "git")
+	if cmds := e.r.Commands(); len(cmds) != 0 {
+		t.Fatalf("uninstall changed a value apprecert did not set: %q", cmds)
+	}
+}
+
+func TestGitURLs(t *testing.T) {
+	e := newEnv(t)
+	e.systemRoots(t)
+	e.r.Provide("git")
+	e.cfg.GitURLs = []string{"https://git.test/"}
+	bundle := filepath.Join(e.cfg.CAROOT, "git-ca-bundle.pem")
+	key := "http.https://git.test/.sslCAInfo"
+
+	e.install(t, "git")
+	want := "git config --global " + key + " " + bundle
+	if cmds := e.r.Commands(); len(cmds) != 1 || cmds[0] != want {
+		t.Fatalf("commands %q, want [%s]", cmds, want)
+	}
+
+	e.gitConfig(key, bundle)
+	e.reinstall(t, "git")
+
+	e.r.Reset()
+	e.uninstall(t, "git")
+	want = "git config --global --unset " + key
+	if cmds := e.r.Commands(); len(cmds) != 1 || cmds[0] != want {
+		t.Fatalf("commands %q, want [%s]", cmds, want)
+	}
+}
+
+func TestGitConfigFailure(t *testing.T) {
+	e := newEnv(t)
+	e.systemRoots(t)
+	e.r.Provide("git").
+		On(trusttest.Response{Stderr: "could not lock config file", ExitCode: 255}, "git", "config", "--global", "http.sslCAInfo")
+
+	results, err := truststore.Install(e.cfg, truststore.Selection{Only: []string{"git"}})
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if results.Err() == nil {
+		t.Fatal("Install succeeded although git config failed")
+	}
+	if _, err := os.Stat(filepath.Join(e.cfg.CAROOT, "git-ca-bundle.pem")); !os.IsNotExist(err) {
+		t.Fatal("bundle left after rollback")
+	}
+}
+
+func TestGitRollbackRestoresConfig(t *testing.T) {
+	e := newEnv(t)
+	e.systemRoots(t)
+	e.nssDB(t)
+	e.r.Provide("git", "certutil").
+		On(trusttest.Response{Stderr: "SEC_ERROR_BAD_DATABASE", ExitCode: 1}, "certutil", "-A")
+	e.gitConfig("http.sslCAInfo", "/etc/corp.pem")
+	configFile := filepath.Join(e.cfg.CAROOT, "config.json")
+	const settings = "{\n  \"gitURLs\": []\n}\n"
+	writeFile(t, configFile, []byte(settings))
+
+	results, err := truststore.Install(e.cfg, truststore.Selection{Only: []string{"git", "nss"}})
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if results.Err() == nil {
+		t.Fatal("Install succeeded although certutil failed")
+	}
+	if data := readFile(t, configFile); data != settings {
+		t.Fatalf("config.json after rollback:\n%s", data)
+	}
+	if e.cfg.GitPreviousCAInfo != "" {
+		t.Fatalf("previous http.sslCAInfo %q kept after rollback", e.cfg.GitPreviousCAInfo)
+	}
+}
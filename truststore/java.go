@@ -1,78 +1,274 @@
 package truststore
 
 import (
-	"bytes"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 
 	"github.com/appremon/apprecert/config"
+	"github.com/appremon/apprecert/keystore"
 )
 
 // Default values for Java trust store
 const (
 	defaultStorePass = "changeit" // Default password for cacerts
 	cacertsFileName  = "cacerts"
+	javaAlias        = "apprecert-rootCA"
+
+	// debianJavaCacerts is the cacerts that Debian and Ubuntu JDKs link to.
+	// ca-certificates-java regenerates it from the system trust store.
+	debianJavaCacerts = "/etc/ssl/certs/java/cacerts"
 )
 
-// JavaTrustStore contains Java trust store configuration.
+// JavaTrustStore is the cacerts trust store of one JDK. It is edited
+// directly, so neither keytool nor JAVA_HOME is needed.
 type JavaTrustStore struct {
-	keytoolPath string
-	cacertsPath string
-	storePass   string
+	JDKHome     string
+	CacertsPath string
+	StorePass   string
+
+	// SystemManaged marks a cacerts generated from the system trust store,
+	// which is left to the system store instead of being edited.
+	SystemManaged bool
 }
 
-// NewJavaTrustStore initializes a new JavaTrustStore.
+// NewJavaTrustStore returns the trust store of the JDK in JAVA_HOME.
 func NewJavaTrustStore() (*JavaTrustStore, error) {
 	javaHome := os.Getenv("JAVA_HOME")
 	if javaHome == "" {
 		return nil, fmt.Errorf("JAVA_HOME is not set")
 	}
+	cacertsPath, ok := findCacerts(javaHome)
+	if !ok {
+		return nil, fmt.Errorf("cacerts file not found in JAVA_HOME")
+	}
+	return &JavaTrustStore{JDKHome: javaHome, CacertsPath: cacertsPath, StorePass: defaultStorePass}, nil
+}
 
-	keytoolPath := filepath.Join(javaHome, "bin", "keytool")
-	cacertsPath := filepath.Join(javaHome, "lib", "security", cacertsFileName)
+// FindJavaTrustStores discovers the JDKs on this machine: JAVA_HOME, the
+// system JVM directories, SDKMAN, asdf and Gradle toolchains. A cacerts file
+// shared by several JDKs, like Debian's /etc/ssl/certs/java/cacerts, is
+// returned once, and marked SystemManaged. Store passwords are taken from
+// cfg.JavaStorePasswords.
+func FindJavaTrustStores(cfg *config.Config) []*JavaTrustStore {
+	var stores []*JavaTrustStore
+	seen := make(map[string]bool)
+	shared, _ := filepath.EvalSymlinks(hostPath(debianJavaCacerts))
+	for _, home := range jdkHomes() {
+		linkPath, ok := findCacerts(home)
+		if !ok {
+			continue
+		}
+		cacertsPath := linkPath
+		if resolved, err := filepath.EvalSymlinks(linkPath); err == nil {
+			cacertsPath = resolved
+		}
+		if seen[cacertsPath] {
+			continue
+		}
+		seen[cacertsPath] = true
+		stores = append(stores, &JavaTrustStore{
+			JDKHome:       home,
+			CacertsPath:   cacertsPath,
+			StorePass:     javaStorePass(cfg, home, linkPath, cacertsPath),
+			SystemManaged: shared != "" && cacertsPath == shared,
+		})
+	}
+	return stores
+}
 
-	if _, err := os.Stat(keytoolPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("keytool not found in JAVA_HOME")
+// jdkHomes lists candidate JDK installation directories, JAVA_HOME first.
+func jdkHomes() []string {
+	var homes []string
+	if javaHome := os.Getenv("JAVA_HOME"); javaHome != "" {
+		homes = append(homes, javaHome)
 	}
-	if _, err := os.Stat(cacertsPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("cacerts file not found in JAVA_HOME")
+	userHome, _ := os.UserHomeDir()
+	patterns := []string{
+		hostPath("/usr/lib/jvm/*"),
+		hostPath("/usr/lib64/jvm/*"),
+		hostPath("/Library/Java/JavaVirtualMachines/*/Contents/Home"),
+		filepath.Join(os.Getenv("ProgramFiles"), "Java", "*"),
+	}
+	if userHome != "" {
+		patterns = append(patterns,
+			filepath.Join(userHome, "Library/Java/JavaVirtualMachines/*/Contents/Home"),
+			filepath.Join(userHome, ".sdkman/candidates/java/*"),
+			filepath.Join(userHome, ".asdf/installs/java/*"),
+			filepath.Join(userHome, ".gradle/jdks/*"),
+			filepath.Join(userHome, ".gradle/jdks/*/Contents/Home"),
+		)
+	}
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(pattern)
+		homes = append(homes, matches...)
+	}
+	return homes
+}
+
+// findCacerts locates the cacerts file of a JDK (lib/security) or of a
+// Java 8 JDK's bundled JRE (jre/lib/security).
+func findCacerts(home string) (string, bool) {
+	for _, dir := range []string{"lib", filepath.Join("jre", "lib")} {
+		path := filepath.Join(home, dir, "security", cacertsFileName)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// javaStorePass returns the configured password for a JDK, looked up by its
+// home or its cacerts path, as found in the JDK or with symlinks resolved,
+// or the default "changeit".
+func javaStorePass(cfg *config.Config, home string, cacertsPaths ...string) string {
+	for _, key := range append([]string{home}, cacertsPaths...) {
+		if pass, ok := cfg.JavaStorePasswords[key]; ok {
+			return pass
+		}
 	}
+	return defaultStorePass
+}
 
-	return &JavaTrustStore{
-		keytoolPath: keytoolPath,
-		cacertsPath: cacertsPath,
-		storePass:   defaultStorePass,
-	}, nil
+// load decodes the cacerts file.
+func (j *JavaTrustStore) load() (*keystore.KeyStore, error) {
+	data, err := os.ReadFile(j.CacertsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", j.CacertsPath, err)
+	}
+	ks, err := keystore.Decode(data, j.StorePass)
+	if errors.Is(err, keystore.ErrIncorrectPassword) {
+		return nil, fmt.Errorf("wrong store password for %s; pass -java-store-password %s=<password>", j.CacertsPath, j.JDKHome)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", j.CacertsPath, err)
+	}
+	return ks, nil
 }
 
-// Install adds the CA certificate to the Java trust store.
+// save writes the cacerts file back, as root if the user cannot write it.
+func (j *JavaTrustStore) save(ks *keystore.KeyStore) error {
+	data, err := ks.Encode(j.StorePass)
+	if errors.Is(err, keystore.ErrLegacyEncryption) {
+		return fmt.Errorf("%w; convert it with a current JDK's keytool -importkeystore", err)
+	}
+	if err != nil {
+		return err
+	}
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(j.CacertsPath); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return CurrentRunner().WriteFile(j.CacertsPath, data, perm, needsRoot(j.CacertsPath))
+}
+
+// Install adds the CA certificate to the Java trust store. A SystemManaged
+// store is left alone, as it would be regenerated without the CA.
 func (j *JavaTrustStore) Install(cfg *config.Config) error {
-	certPath := filepath.Join(cfg.CAROOT, "rootCA.pem")
-	cmd := exec.Command(j.keytoolPath, "-importcert", "-noprompt",
-		"-keystore", j.cacertsPath,
-		"-storepass", j.storePass,
-		"-file", certPath,
-		"-alias", "apprecert-rootCA",
-	)
-	output, err := cmd.CombinedOutput()
+	if j.SystemManaged {
+		addNote("%s is generated by ca-certificates-java from the system trust store; install the system store to trust the CA in Java", j.CacertsPath)
+		return nil
+	}
+	caCert, err := cfg.LoadRootCert()
 	if err != nil {
-		return fmt.Errorf("failed to install certificate in Java trust store: %s", output)
+		return err
+	}
+	ks, err := j.load()
+	if err != nil {
+		return err
+	}
+	if cert, ok := ks.Certificate(javaAlias); ok && cert.Equal(caCert) {
+		return nil // Already installed
+	}
+	ks.SetCertificate(javaAlias, caCert)
+	if err := j.save(ks); err != nil {
+		return fmt.Errorf("failed to install certificate in Java trust store %s: %w", j.CacertsPath, err)
 	}
 	return nil
 }
 
 // Uninstall removes the CA certificate from the Java trust store.
 func (j *JavaTrustStore) Uninstall() error {
-	cmd := exec.Command(j.keytoolPath, "-delete",
-		"-keystore", j.cacertsPath,
-		"-storepass", j.storePass,
-		"-alias", "apprecert-rootCA",
-	)
-	output, err := cmd.CombinedOutput()
-	if err != nil && !bytes.Contains(output, []byte("does not exist")) {
-		return fmt.Errorf("failed to remove certificate from Java trust store: %s", output)
+	ks, err := j.load()
+	if err != nil {
+		return err
+	}
+	if !ks.Delete(javaAlias) {
+		return nil // Not present
+	}
+	if err := j.save(ks); err != nil {
+		return fmt.Errorf("failed to remove certificate from Java trust store %s: %w", j.CacertsPath, err)
 	}
 	return nil
 }
+
+// state reports whether caCert is trusted under our alias, or under any
+// alias in a SystemManaged store.
+func (j *JavaTrustStore) state(caCert *x509.Certificate) (State, error) {
+	ks, err := j.load()
+	if err != nil {
+		return "", err
+	}
+	if j.SystemManaged && ks.HasCertificate(caCert) {
+		return StatePresent, nil
+	}
+	cert, ok := ks.Certificate(javaAlias)
+	switch {
+	case !ok:
+		return StateAbsent, nil
+	case cert.Equal(caCert):
+		return StatePresent, nil
+	default:
+		// Anything else under our alias is a leftover from an older CA
+		return StateStale, nil
+	}
+}
+
+// javaStore covers the cacerts trust store of every JDK found.
+type javaStore struct{}
+
+func (javaStore) Name() string { return "java" }
+
+func (javaStore) Detect(cfg *config.Config) error {
+	if len(FindJavaTrustStores(cfg)) == 0 {
+		return fmt.Errorf("no JDK found (JAVA_HOME, /usr/lib/jvm, SDKMAN, asdf or Gradle)")
+	}
+	return nil
+}
+
+func (javaStore) Install(cfg *config.Config) error {
+	var errs []error
+	for _, j := range FindJavaTrustStores(cfg) {
+		errs = append(errs, j.Install(cfg))
+	}
+	return errors.Join(errs...)
+}
+
+func (javaStore) Uninstall(cfg *config.Config) error {
+	var errs []error
+	for _, j := range FindJavaTrustStores(cfg) {
+		errs = append(errs, j.Uninstall())
+	}
+	return errors.Join(errs...)
+}
+
+func (javaStore) Check(cfg *config.Config) ([]Status, error) {
+	caCert, err := cfg.LoadRootCert()
+	if err != nil {
+		return nil, err
+	}
+	var statuses []Status
+	for _, j := range FindJavaTrustStores(cfg) {
+		status := Status{Store: "java", Location: j.CacertsPath}
+		if j.SystemManaged {
+			status.Detail = "generated from the system trust store"
+		}
+		if status.State, err = j.state(caCert); err != nil {
+			status.State, status.Detail = StateUnknown, err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
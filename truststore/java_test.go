@@ -0,0 +1,222 @@
+package truststore_test
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appremon/apprecert/keystore"
+	"github.com/appremon/apprecert/truststore"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// javaAlias is the alias the root CA is stored under in cacerts.
+const javaAlias = "apprecert-rootCA"
+
+// jdk creates a JDK in JAVA_HOME whose cacerts is a key store of the given
+// format and password holding certs, and returns the cacerts path.
+func (e *env) jdk(t *testing.T, ks *keystore.KeyStore, password string, certs ...*x509.Certificate) string {
+	t.Helper()
+	home := filepath.Join(t.TempDir(), "jdk")
+	t.Setenv("JAVA_HOME", home)
+	for _, c := range certs {
+		ks.SetCertificate(c.Subject.CommonName, c)
+	}
+	data, err := ks.Encode(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(home, "lib", "security", "cacerts")
+	writeFile(t, path, data)
+	return path
+}
+
+// loadCacerts decodes a cacerts file.
+func loadCacerts(t *testing.T, path, password string) *keystore.KeyStore {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, err := keystore.Decode(data, password)
+	if err != nil {
+		t.Fatalf("Decode %s: %v", path, err)
+	}
+	return ks
+}
+
+func TestJavaInstallUninstall(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ks   *keystore.KeyStore
+	}{
+		{"JKS", &keystore.KeyStore{Format: keystore.JKS}},
+		{"PKCS12", &keystore.KeyStore{Format: keystore.PKCS12}},
+		{"passwordless PKCS12", &keystore.KeyStore{Format: keystore.PKCS12, Passwordless: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newEnv(t)
+			other := otherCert(t)
+			cacerts := e.jdk(t, tc.ks, "changeit", other)
+
+			e.install(t, "java")
+			ks := loadCacerts(t, cacerts, "changeit")
+			root, err := e.cfg.LoadRootCert()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c, ok := ks.Certificate(javaAlias); !ok || !c.Equal(root) {
+				t.Fatal("root CA not stored under its alias")
+			}
+			if ks.Format != tc.ks.Format || ks.Passwordless != tc.ks.Passwordless || !ks.HasCertificate(other) {
+				t.Fatalf("cacerts format or entries changed: %v, passwordless %v, aliases %q", ks.Format, ks.Passwordless, ks.Aliases())
+			}
+			if state := e.state(t, "java"); state != truststore.StatePresent {
+				t.Fatalf("state %s after install, want present", state)
+			}
+			e.reinstall(t, "java")
+
+			e.uninstall(t, "java")
+			ks = loadCacerts(t, cacerts, "changeit")
+			if _, ok := ks.Certificate(javaAlias); ok {
+				t.Fatal("root CA left in cacerts")
+			}
+			if !ks.HasCertificate(other) {
+				t.Fatal("uninstall removed another certificate")
+			}
+		})
+	}
+}
+
+func TestJavaStorePassword(t *testing.T) {
+	e := newEnv(t)
+	cacerts := e.jdk(t, &keystore.KeyStore{Format: keystore.JKS}, "s3cret")
+	before := readFile(t, cacerts)
+
+	results, err := truststore.Install(e.cfg, truststore.Selection{Only: []string{"java"}})
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if err := results.Err(); err == nil || !strings.Contains(err.Error(), "-java-store-password") {
+		t.Fatalf("Install: got %v, want a hint at -java-store-password", err)
+	}
+	if readFile(t, cacerts) != before {
+		t.Fatal("cacerts changed despite the wrong password")
+	}
+	if state := e.state(t, "java"); state != truststore.StateUnknown {
+		t.Fatalf("state %s with the wrong password, want unknown", state)
+	}
+
+	e.cfg.JavaStorePasswords = map[string]string{os.Getenv("JAVA_HOME"): "s3cret"}
+	e.install(t, "java")
+	if _, ok := loadCacerts(t, cacerts, "s3cret").Certificate(javaAlias); !ok {
+		t.Fatal("root CA not installed with the configured password")
+	}
+}
+
+func TestJavaLegacyPKCS12IsLeftAlone(t *testing.T) {
+	e := newEnv(t)
+	other := otherCert(t)
+	data, err := pkcs12.LegacyRC2.WithRand(rand.Reader).EncodeTrustStoreEntries(
+		[]pkcs12.TrustStoreEntry{{Cert: other, FriendlyName: "corp-root"}}, "changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	home := filepath.Join(t.TempDir(), "jdk")
+	t.Setenv("JAVA_HOME", home)
+	cacerts := filepath.Join(home, "lib", "security", "cacerts")
+	writeFile(t, cacerts, data)
+
+	results, err := truststore.Install(e.cfg, truststore.Selection{Only: []string{"java"}})
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if err := results.Err(); err == nil || !strings.Contains(err.Error(), "legacy encryption") {
+		t.Fatalf("Install: got %v, want the legacy encryption error", err)
+	}
+	if readFile(t, cacerts) != string(data) {
+		t.Fatal("legacy cacerts was rewritten")
+	}
+}
+
+func TestJavaNoJDK(t *testing.T) {
+	e := newEnv(t)
+	if _, err := truststore.Install(e.cfg, truststore.Selection{Only: []string{"java"}}); err == nil || !strings.Contains(err.Error(), "no JDK found") {
+		t.Fatalf("Install: got %v, want no JDK found", err)
+	}
+}
+
+// symlinkCacerts makes home/lib/security/cacerts a symlink to target and
+// returns the link.
+func symlinkCacerts(t *testing.T, home, target string) string {
+	t.Helper()
+	link := filepath.Join(home, "lib", "security", "cacerts")
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	return link
+}
+
+func TestJavaLeavesDebianCacertsToSystemStore(t *testing.T) {
+	e := newEnv(t)
+	ks := &keystore.KeyStore{Format: keystore.JKS}
+	ks.SetCertificate("debian:corp.pem", otherCert(t))
+	data, err := ks.Encode("changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := e.hostFile("/etc/ssl/certs/java/cacerts")
+	writeFile(t, shared, data)
+	symlinkCacerts(t, e.hostFile("/usr/lib/jvm/java-17-openjdk-amd64"), shared)
+
+	results := e.install(t, "java")
+	if readFile(t, shared) != string(data) {
+		t.Fatal("Debian's generated cacerts was edited")
+	}
+	if notes := strings.Join(results[0].Notes, "\n"); !strings.Contains(notes, "ca-certificates-java") {
+		t.Fatalf("notes %q, want a pointer to the system store", notes)
+	}
+	if state := e.state(t, "java"); state != truststore.StateAbsent {
+		t.Fatalf("state %s, want absent", state)
+	}
+
+	// update-ca-certificates adds the CA under its own alias
+	root, err := e.cfg.LoadRootCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks.SetCertificate("debian:apprecert.pem", root)
+	if data, err = ks.Encode("changeit"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, shared, data)
+	if state := e.state(t, "java"); state != truststore.StatePresent {
+		t.Fatalf("state %s with the CA added by the system store, want present", state)
+	}
+}
+
+func TestJavaStorePasswordForLinkedCacerts(t *testing.T) {
+	e := newEnv(t)
+	ks := &keystore.KeyStore{Format: keystore.JKS}
+	data, err := ks.Encode("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(t.TempDir(), "cacerts")
+	writeFile(t, target, data)
+	home := filepath.Join(t.TempDir(), "jdk")
+	t.Setenv("JAVA_HOME", home)
+	link := symlinkCacerts(t, home, target)
+
+	e.cfg.JavaStorePasswords = map[string]string{link: "s3cret"}
+	e.install(t, "java")
+	if _, ok := loadCacerts(t, target, "s3cret").Certificate(javaAlias); !ok {
+		t.Fatal("root CA not installed with the password configured for the linked path")
+	}
+}
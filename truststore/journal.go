@@ -0,0 +1,253 @@
+package truststore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/appremon/apprecert/config"
+)
+
+// journalFile records the changes of an install in progress inside CAROOT.
+const journalFile = "install-journal.json"
+
+// ErrNoJournal is returned by Rollback when there is nothing to roll back.
+var ErrNoJournal = errors.New("no interrupted install to roll back")
+
+// change is one journaled modification and how to revert it.
+type change struct {
+	Store string `json:"store"`
+
+	// A file write or removal, reverted by restoring the previous contents,
+	// or a created directory, reverted by removing it
+	Path     string      `json:"path,omitempty"`
+	Existed  bool        `json:"existed,omitempty"`
+	Previous []byte      `json:"previous,omitempty"`
+	Perm     os.FileMode `json:"perm,omitempty"`
+
+	// A command, reverted by running Undo. Refresh commands, such as
+	// update-ca-certificates, are instead re-run after the store's other
+	// changes have been reverted.
+	Undo    []string `json:"undo,omitempty"`
+	Refresh bool     `json:"refresh,omitempty"`
+
+	// A Kubernetes object, reverted by the client instead of a command
+	Kube *kubeChange `json:"kube,omitempty"`
+
+	Sudo bool `json:"sudo,omitempty"`
+}
+
+// journal is the persistent record of an install, kept so that a failed or
+// interrupted install can be rolled back.
+type journal struct {
+	mu      sync.Mutex
+	path    string
+	store   string
+	Changes []change `json:"changes"`
+}
+
+// beginJournal starts a journal in CAROOT, refusing to if one is left over
+// from an interrupted install.
+func beginJournal(cfg *config.Config) (*journal, error) {
+	path := filepath.Join(cfg.CAROOT, journalFile)
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("a previous install was interrupted; run 'apprecert rollback' first")
+	}
+	j := &journal{path: path}
+	return j, j.save()
+}
+
+// loadJournal reads the journal left in CAROOT.
+func loadJournal(cfg *config.Config) (*journal, error) {
+	path := filepath.Join(cfg.CAROOT, journalFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoJournal
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read install journal: %w", err)
+	}
+	j := &journal{path: path}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("failed to parse install journal: %w", err)
+	}
+	return j, nil
+}
+
+func (j *journal) save() error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(j.path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write install journal: %w", err)
+	}
+	return nil
+}
+
+// setStore attributes the following changes to the named store.
+func (j *journal) setStore(name string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.store = name
+}
+
+// add records a change and persists the journal.
+func (j *journal) add(c change) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	c.Store = j.store
+	j.Changes = append(j.Changes, c)
+	return j.save()
+}
+
+// remove deletes the journal once its changes are committed or reverted.
+func (j *journal) remove() error {
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove install journal: %w", err)
+	}
+	return nil
+}
+
+// rollback reverts the journaled changes in reverse order through r. Each
+// store's refresh commands run once its other changes are reverted.
+func (j *journal) rollback(r Runner) error {
+	var errs []error
+	var refresh []change
+	runRefresh := func() {
+		for _, c := range refresh {
+			if _, err := r.Run(c.Sudo, c.Undo[0], c.Undo[1:]...); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", c.Store, err))
+			}
+		}
+		refresh = nil
+	}
+
+	for i := len(j.Changes) - 1; i >= 0; i-- {
+		c := j.Changes[i]
+		if len(refresh) > 0 && refresh[0].Store != c.Store {
+			runRefresh()
+		}
+		var err error
+		switch {
+		case c.Refresh:
+			refresh = append(refresh, c)
+		case c.Path != "" && c.Existed:
+			err = r.WriteFile(c.Path, c.Previous, c.Perm, c.Sudo)
+		case c.Path != "":
+			err = r.Remove(c.Path, c.Sudo)
+		case len(c.Undo) > 0:
+			_, err = r.Run(c.Sudo, c.Undo[0], c.Undo[1:]...)
+		case c.Kube != nil:
+			err = r.Apply(c.Kube.String(), c.Kube.revert)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.Store, err))
+		}
+	}
+	runRefresh()
+	return errors.Join(errs...)
+}
+
+// journalRunner journals the file changes made through a Runner.
+type journalRunner struct {
+	Runner
+	j *journal
+}
+
+func (r journalRunner) WriteFile(path string, data []byte, perm os.FileMode, sudo bool) error {
+	if err := r.recordFile(path, sudo); err != nil {
+		return err
+	}
+	return r.Runner.WriteFile(path, data, perm, sudo)
+}
+
+func (r journalRunner) Remove(path string, sudo bool) error {
+	if err := r.recordFile(path, sudo); err != nil {
+		return err
+	}
+	return r.Runner.Remove(path, sudo)
+}
+
+// recordFile journals the current contents of path before it is changed.
+func (r journalRunner) recordFile(path string, sudo bool) error {
+	c := change{Path: path, Sudo: sudo}
+	info, err := os.Stat(path)
+	switch {
+	case err == nil:
+		c.Existed = true
+		c.Perm = info.Mode().Perm()
+		if c.Previous, err = os.ReadFile(path); err != nil {
+			return fmt.Errorf("failed to save %s for rollback: %w", path, err)
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("failed to save %s for rollback: %w", path, err)
+	}
+	return r.j.add(c)
+}
+
+// recordUndo journals the command that reverts a successful change, when
+// the change was made by a transactional install.
+func recordUndo(sudo bool, undo ...string) error {
+	if r, ok := CurrentRunner().(journalRunner); ok {
+		return r.j.add(change{Undo: undo, Sudo: sudo})
+	}
+	return nil
+}
+
+// recordDir journals the creation of a directory, reverted by removing it
+// once the files created in it are gone. With sudo, it is removed as root.
+func recordDir(dir string, sudo bool) error {
+	if r, ok := CurrentRunner().(journalRunner); ok {
+		return r.j.add(change{Path: dir, Sudo: sudo})
+	}
+	return nil
+}
+
+// saveConfig saves cfg to config.json, first journaling the file so that a
+// rollback restores the settings it held before the install.
+func saveConfig(cfg *config.Config, action string) error {
+	if r, ok := CurrentRunner().(journalRunner); ok {
+		if err := r.recordFile(filepath.Join(cfg.CAROOT, config.ConfigFile), false); err != nil {
+			return err
+		}
+	}
+	return CurrentRunner().Apply(action, cfg.Save)
+}
+
+// recordKubeUndo journals how to revert a Kubernetes change.
+func recordKubeUndo(undo *kubeChange) error {
+	if r, ok := CurrentRunner().(journalRunner); ok {
+		return r.j.add(change{Kube: undo})
+	}
+	return nil
+}
+
+// recordRefresh journals a command that rebuilds a store from its sources,
+// to be re-run after a rollback.
+func recordRefresh(sudo bool, argv ...string) error {
+	if r, ok := CurrentRunner().(journalRunner); ok {
+		return r.j.add(change{Undo: argv, Refresh: true, Sudo: sudo})
+	}
+	return nil
+}
+
+// Rollback reverts the changes of an install that was interrupted before it
+// could finish or roll itself back, as recorded in the journal in CAROOT.
+func Rollback(cfg *config.Config) error {
+	j, err := loadJournal(cfg)
+	if err != nil {
+		return err
+	}
+	runner := CurrentRunner()
+	if err := j.rollback(runner); err != nil {
+		return err
+	}
+	if _, dryRun := runner.(*Recorder); dryRun {
+		return nil
+	}
+	return j.remove()
+}
@@ -1,52 +1,191 @@
 package truststore
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
 	"github.com/appremon/apprecert/config"
+	"github.com/appremon/apprecert/kube"
+)
+
+// The ConfigMap the root CA is published in, as ca.crt.
+const (
+	kubeNamespace = "kube-system"
+	kubeConfigMap = "custom-ca-bundle"
+	kubeCAKey     = "ca.crt"
 )
 
-// InstallKubernetes updates the Kubernetes cluster to trust the custom CA.
+// kubeOptions selects the cluster from cfg. The ConfigMap goes into
+// kube-system unless another namespace is given.
+func kubeOptions(cfg *config.Config) kube.Options {
+	namespace := cfg.KubeNamespace
+	if namespace == "" {
+		namespace = kubeNamespace
+	}
+	return kube.Options{Kubeconfig: cfg.Kubeconfig, Context: cfg.KubeContext, Namespace: namespace}
+}
+
+// kubeChange is a journaled ConfigMap change, reverted by restoring the
+// previous ca.crt or deleting a ConfigMap that did not exist.
+type kubeChange struct {
+	Options  kube.Options      `json:"options"`
+	Name     string            `json:"name"`
+	Existed  bool              `json:"existed,omitempty"`
+	Previous map[string]string `json:"previous,omitempty"`
+}
+
+func (c *kubeChange) String() string {
+	return fmt.Sprintf("restore ConfigMap %s/%s", c.Options.Namespace, c.Name)
+}
+
+// revert restores the ConfigMap to its state before the install.
+func (c *kubeChange) revert() error {
+	client, namespace, err := kube.NewClient(c.Options)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kube.Timeout)
+	defer cancel()
+	if !c.Existed {
+		return kube.DeleteConfigMap(ctx, client, namespace, c.Name)
+	}
+	previous, ok := c.Previous[kubeCAKey]
+	if !ok {
+		return kube.RemoveConfigMapKey(ctx, client, namespace, c.Name, kubeCAKey)
+	}
+	return kube.ApplyConfigMap(ctx, client, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: c.Name, Namespace: namespace},
+		Data:       map[string]string{kubeCAKey: previous},
+	})
+}
+
+// InstallKubernetes publishes the root CA as the custom-ca-bundle ConfigMap,
+// creating it labelled as managed by apprecert, or setting ca.crt in an
+// existing one and keeping its other keys.
 func InstallKubernetes(cfg *config.Config) error {
 	certPath := filepath.Join(cfg.CAROOT, "rootCA.pem")
-	if _, err := os.Stat(certPath); os.IsNotExist(err) {
-		return fmt.Errorf("certificate not found at %s", certPath)
+	certBytes, err := os.ReadFile(certPath)
+	if err != nil {
+		return fmt.Errorf("failed to read certificate: %w", err)
 	}
 
-	// Check if the ConfigMap already exists
-	checkCmd := exec.Command("kubectl", "get", "configmap", "custom-ca-bundle", "-n", "kube-system")
-	if err := checkCmd.Run(); err == nil {
-		return fmt.Errorf("ConfigMap 'custom-ca-bundle' already exists in namespace 'kube-system'")
+	opts := kubeOptions(cfg)
+	client, namespace, err := kube.NewClient(opts)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kube.Timeout)
+	defer cancel()
+	existing, err := kube.GetConfigMap(ctx, client, namespace, kubeConfigMap)
+	if err != nil {
+		return err
+	}
+	undo := &kubeChange{Options: opts, Name: kubeConfigMap}
+	action := "create"
+	if existing != nil {
+		if existing.Data[kubeCAKey] == string(certBytes) {
+			return nil // Already installed
+		}
+		undo.Existed, undo.Previous = true, existing.Data
+		action = "update"
 	}
 
-	// Create a ConfigMap for the CA bundle
-	cmd := exec.Command("kubectl", "create", "configmap", "custom-ca-bundle",
-		"--from-file=ca.crt="+certPath, "-n", "kube-system")
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to create ConfigMap: %s, %w", output, err)
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      kubeConfigMap,
+			Namespace: namespace,
+			Labels:    map[string]string{kube.ManagedByLabel: "apprecert"},
+		},
+		Data: map[string]string{kubeCAKey: string(certBytes)},
 	}
+	return CurrentRunner().Apply(fmt.Sprintf("%s ConfigMap %s/%s", action, namespace, kubeConfigMap), func() error {
+		if err := kube.ApplyConfigMap(ctx, client, cm); err != nil {
+			return err
+		}
+		return recordKubeUndo(undo)
+	})
+}
 
-	// Patch the cluster to include the ConfigMap
-	patchCmd := exec.Command("kubectl", "patch", "cm", "kubeadm-config", "-n", "kube-system",
-		"--type=json", "-p",
-		"[{\"op\": \"add\", \"path\": \"/data/ClusterConfiguration/certificatesDir\", \"value\": \"/etc/kubernetes/pki/custom-ca-bundle\"}]")
-	if output, err := patchCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to patch cluster configuration: %s, %w", output, err)
+// UninstallKubernetes deletes the custom-ca-bundle ConfigMap if apprecert
+// created it. From a ConfigMap created by someone else, only a ca.crt
+// holding the root CA, or an older one with its subject, is removed.
+func UninstallKubernetes(cfg *config.Config) error {
+	caCert, err := cfg.LoadRootCert()
+	if err != nil {
+		return err
+	}
+	client, namespace, err := kube.NewClient(kubeOptions(cfg))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kube.Timeout)
+	defer cancel()
+	existing, err := kube.GetConfigMap(ctx, client, namespace, kubeConfigMap)
+	if err != nil || existing == nil {
+		return err
 	}
+	if !kubeManaged(existing) {
+		if matchPEM([]byte(existing.Data[kubeCAKey]), caCert) == StateAbsent {
+			return nil
+		}
+		return CurrentRunner().Apply(fmt.Sprintf("remove %s from ConfigMap %s/%s", kubeCAKey, namespace, kubeConfigMap), func() error {
+			return kube.RemoveConfigMapKey(ctx, client, namespace, kubeConfigMap, kubeCAKey)
+		})
+	}
+	return CurrentRunner().Apply(fmt.Sprintf("delete ConfigMap %s/%s", namespace, kubeConfigMap), func() error {
+		return kube.DeleteConfigMap(ctx, client, namespace, kubeConfigMap)
+	})
+}
 
-	return nil
+// kubeManaged reports whether apprecert created cm.
+func kubeManaged(cm *corev1.ConfigMap) bool {
+	return cm.Labels[kube.ManagedByLabel] == "apprecert"
 }
 
-// UninstallKubernetes removes the custom CA from the Kubernetes cluster.
-func UninstallKubernetes(cfg *config.Config) error {
-	// Remove the ConfigMap
-	cmd := exec.Command("kubectl", "delete", "configmap", "custom-ca-bundle", "-n", "kube-system")
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to delete ConfigMap: %s, %w", output, err)
+// kubernetesStore publishes the root CA as a ConfigMap in the selected cluster.
+type kubernetesStore struct{}
+
+func (kubernetesStore) Name() string { return "kubernetes" }
+
+func (kubernetesStore) Detect(cfg *config.Config) error {
+	client, _, err := kube.NewClient(kubeOptions(cfg))
+	if err != nil {
+		return err
 	}
+	return kube.Ping(client)
+}
+
+func (kubernetesStore) Install(cfg *config.Config) error { return InstallKubernetes(cfg) }
+
+func (kubernetesStore) Uninstall(cfg *config.Config) error { return UninstallKubernetes(cfg) }
 
-	return nil
+func (kubernetesStore) Check(cfg *config.Config) ([]Status, error) {
+	caCert, err := cfg.LoadRootCert()
+	if err != nil {
+		return nil, err
+	}
+	client, namespace, err := kube.NewClient(kubeOptions(cfg))
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kube.Timeout)
+	defer cancel()
+	cm, err := kube.GetConfigMap(ctx, client, namespace, kubeConfigMap)
+	if err != nil {
+		return nil, err
+	}
+	status := Status{Store: "kubernetes", Location: namespace + "/" + kubeConfigMap, State: StateAbsent}
+	if cm != nil {
+		status.State = matchPEM([]byte(cm.Data[kubeCAKey]), caCert)
+		// In a ConfigMap of ours, any other ca.crt is stale
+		if kubeManaged(cm) && status.State != StatePresent {
+			status.State = StateStale
+		}
+	}
+	return []Status{status}, nil
 }
@@ -0,0 +1,212 @@
+package truststore_test
+
+import (
+	"context"
+	"encoding/pem"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/appremon/apprecert/kube"
+	"github.com/appremon/apprecert/truststore"
+	"github.com/appremon/apprecert/truststore/trusttest"
+)
+
+// fakeCluster makes the kubernetes store use a fake clientset holding
+// objects, and returns it.
+func fakeCluster(t *testing.T, objects ...*corev1.ConfigMap) *fake.Clientset {
+	t.Helper()
+	client := fake.NewSimpleClientset()
+	for _, obj := range objects {
+		if _, err := client.CoreV1().ConfigMaps(obj.Namespace).Create(context.Background(), obj, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prev := kube.SetFactory(func(opts kube.Options) (kubernetes.Interface, string, error) {
+		return client, opts.Namespace, nil
+	})
+	t.Cleanup(func() { kube.SetFactory(prev) })
+	return client
+}
+
+// caBundle returns the custom-ca-bundle ConfigMap, or nil if it does not
+// exist.
+func caBundle(t *testing.T, client *fake.Clientset) *corev1.ConfigMap {
+	t.Helper()
+	cm, err := client.CoreV1().ConfigMaps("kube-system").Get(context.Background(), "custom-ca-bundle", metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cm
+}
+
+func TestKubernetesInstallUninstall(t *testing.T) {
+	e := newEnv(t)
+	client := fakeCluster(t)
+
+	e.install(t, "kubernetes")
+	cm := caBundle(t, client)
+	if cm == nil || cm.Data["ca.crt"] != string(rootPEM(t, e.cfg)) {
+		t.Fatalf("ConfigMap after install: %+v", cm)
+	}
+	if cm.Labels[kube.ManagedByLabel] != "apprecert" {
+		t.Fatalf("ConfigMap labels %v, want managed by apprecert", cm.Labels)
+	}
+	if state := e.state(t, "kubernetes"); state != truststore.StatePresent {
+		t.Fatalf("state %s after install, want present", state)
+	}
+
+	client.ClearActions()
+	e.reinstall(t, "kubernetes")
+	for _, action := range client.Actions() {
+		if action.GetVerb() != "get" {
+			t.Fatalf("second install changed the cluster: %s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+
+	e.uninstall(t, "kubernetes")
+	if cm := caBundle(t, client); cm != nil {
+		t.Fatal("ConfigMap left after uninstall")
+	}
+	if state := e.state(t, "kubernetes"); state != truststore.StateAbsent {
+		t.Fatalf("state %s after uninstall, want absent", state)
+	}
+}
+
+func TestKubernetesStaleBundle(t *testing.T) {
+	e := newEnv(t)
+	client := fakeCluster(t, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "custom-ca-bundle", Namespace: "kube-system"},
+		Data:       map[string]string{"ca.crt": string(rootPEM(t, newCA(t)))},
+	})
+	if state := e.state(t, "kubernetes"); state != truststore.StateStale {
+		t.Fatalf("state %s, want stale", state)
+	}
+
+	e.install(t, "kubernetes")
+	if cm := caBundle(t, client); cm.Data["ca.crt"] != string(rootPEM(t, e.cfg)) {
+		t.Fatal("stale ca.crt not replaced")
+	}
+}
+
+func TestKubernetesRollbackRestoresConfigMap(t *testing.T) {
+	e := newEnv(t)
+	previous := map[string]string{"ca.crt": "# previous bundle\n", "other": "kept"}
+	client := fakeCluster(t, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "custom-ca-bundle", Namespace: "kube-system"},
+		Data:       previous,
+	})
+	e.nssDB(t)
+	e.r.Provide("certutil").
+		On(trusttest.Response{Stderr: "SEC_ERROR_BAD_DATABASE", ExitCode: 1}, "certutil", "-A")
+
+	results, err := truststore.Install(e.cfg, truststore.Selection{Only: []string{"kubernetes", "nss"}})
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if results.Err() == nil {
+		t.Fatal("Install succeeded although certutil failed")
+	}
+	for _, res := range results {
+		if res.Store == "kubernetes" && !res.RolledBack {
+			t.Fatal("kubernetes not rolled back")
+		}
+	}
+	cm := caBundle(t, client)
+	if cm == nil || len(cm.Data) != len(previous) || cm.Data["ca.crt"] != previous["ca.crt"] || cm.Data["other"] != previous["other"] {
+		t.Fatalf("ConfigMap after rollback: %+v, want data %v", cm, previous)
+	}
+}
+
+func TestKubernetesRollbackDeletesCreatedConfigMap(t *testing.T) {
+	e := newEnv(t)
+	client := fakeCluster(t)
+	e.nssDB(t)
+	e.r.Provide("certutil").
+		On(trusttest.Response{Stderr: "SEC_ERROR_BAD_DATABASE", ExitCode: 1}, "certutil", "-A")
+
+	results, err := truststore.Install(e.cfg, truststore.Selection{Only: []string{"kubernetes", "nss"}})
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if results.Err() == nil {
+		t.Fatal("Install succeeded although certutil failed")
+	}
+	if cm := caBundle(t, client); cm != nil {
+		t.Fatal("ConfigMap created by the failed install was not deleted")
+	}
+}
+
+func TestKubernetesKeepsForeignConfigMap(t *testing.T) {
+	e := newEnv(t)
+	client := fakeCluster(t, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "custom-ca-bundle", Namespace: "kube-system", Labels: map[string]string{"team": "platform"}},
+		Data:       map[string]string{"corp.crt": "# corporate CA\n"},
+		BinaryData: map[string][]byte{"truststore.jks": {1, 2, 3}},
+	})
+
+	e.install(t, "kubernetes")
+	cm := caBundle(t, client)
+	if cm.Data["ca.crt"] != string(rootPEM(t, e.cfg)) || cm.Data["corp.crt"] != "# corporate CA\n" || len(cm.BinaryData["truststore.jks"]) != 3 {
+		t.Fatalf("ConfigMap after install: %+v", cm)
+	}
+	if _, ok := cm.Labels[kube.ManagedByLabel]; ok || cm.Labels["team"] != "platform" {
+		t.Fatalf("labels of a foreign ConfigMap changed: %v", cm.Labels)
+	}
+
+	e.uninstall(t, "kubernetes")
+	cm = caBundle(t, client)
+	if cm == nil {
+		t.Fatal("uninstall deleted a ConfigMap apprecert did not create")
+	}
+	if _, ok := cm.Data["ca.crt"]; ok || cm.Data["corp.crt"] != "# corporate CA\n" || len(cm.BinaryData["truststore.jks"]) != 3 {
+		t.Fatalf("ConfigMap after uninstall: %+v", cm)
+	}
+}
+
+func TestKubernetesUninstallLeavesForeignCA(t *testing.T) {
+	e := newEnv(t)
+	foreign := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: otherCert(t).Raw})
+	client := fakeCluster(t, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "custom-ca-bundle", Namespace: "kube-system"},
+		Data:       map[string]string{"ca.crt": string(foreign)},
+	})
+	if state := e.state(t, "kubernetes"); state != truststore.StateAbsent {
+		t.Fatalf("state %s with another CA in a foreign ConfigMap, want absent", state)
+	}
+
+	e.uninstall(t, "kubernetes")
+	if cm := caBundle(t, client); cm == nil || cm.Data["ca.crt"] != string(foreign) {
+		t.Fatalf("ConfigMap after uninstall: %+v", cm)
+	}
+}
+
+func TestKubernetesRollbackRemovesAddedKey(t *testing.T) {
+	e := newEnv(t)
+	client := fakeCluster(t, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "custom-ca-bundle", Namespace: "kube-system"},
+		Data:       map[string]string{"other": "kept"},
+	})
+	e.nssDB(t)
+	e.r.Provide("certutil").
+		On(trusttest.Response{Stderr: "SEC_ERROR_BAD_DATABASE", ExitCode: 1}, "certutil", "-A")
+
+	results, err := truststore.Install(e.cfg, truststore.Selection{Only: []string{"kubernetes", "nss"}})
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if results.Err() == nil {
+		t.Fatal("Install succeeded although certutil failed")
+	}
+	cm := caBundle(t, client)
+	if cm == nil || len(cm.Data) != 1 || cm.Data["other"] != "kept" {
+		t.Fatalf("ConfigMap after rollback: %+v, want only the other key", cm)
+	}
+}
@@ -1,38 +1,234 @@
 package truststore
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
 	"fmt"
-	"os/exec"
+	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/appremon/apprecert/config"
 )
 
-func installLinux(cfg *config.Config) error {
-	certPath := filepath.Join(cfg.CAROOT, "rootCA.pem")
-	cmd := exec.Command("sudo", "cp", certPath, "/usr/local/share/ca-certificates/rootCA.crt")
-	if err := cmd.Run(); err != nil {
+// legacyAnchorFile is the anchor name used before names were derived from
+// the CA fingerprint. It is cleaned up when it holds our root CA.
+const legacyAnchorFile = "rootCA.crt"
+
+// linuxLayout is how a Linux distribution manages its system trust store.
+type linuxLayout struct {
+	distro    string
+	anchorDir string   // directory of locally added trust anchors
+	refresh   []string // rebuilds the trust store from the anchors
+}
+
+var (
+	debianLayout = linuxLayout{"Debian", "/usr/local/share/ca-certificates", []string{"update-ca-certificates"}}
+	alpineLayout = linuxLayout{"Alpine", "/usr/local/share/ca-certificates", []string{"update-ca-certificates"}}
+	rhelLayout   = linuxLayout{"RHEL/Fedora", "/etc/pki/ca-trust/source/anchors", []string{"update-ca-trust", "extract"}}
+	archLayout   = linuxLayout{"Arch", "/etc/ca-certificates/trust-source/anchors", []string{"trust", "extract-compat"}}
+	suseLayout   = linuxLayout{"openSUSE", "/etc/pki/trust/anchors", []string{"update-ca-certificates"}}
+)
+
+// detectLinux identifies the trust store layout from /etc/os-release,
+// falling back to the tools that are installed.
+func detectLinux() (linuxLayout, error) {
+	ids := osReleaseIDs()
+	for _, id := range ids {
+		var layout linuxLayout
+		switch {
+		case id == "nixos":
+			return linuxLayout{}, fmt.Errorf("the NixOS trust store is read-only; add rootCA.pem from CAROOT to security.pki.certificateFiles in configuration.nix instead")
+		case id == "debian" || id == "ubuntu":
+			layout = debianLayout
+		case id == "alpine":
+			layout = alpineLayout
+		case id == "rhel" || id == "fedora" || id == "centos":
+			layout = rhelLayout
+		case id == "arch":
+			layout = archLayout
+		case id == "suse" || strings.HasPrefix(id, "opensuse") || id == "sles":
+			layout = suseLayout
+		default:
+			continue
+		}
+		if err := lookPath(layout.refresh[0]); err != nil {
+			return linuxLayout{}, fmt.Errorf("%s detected but %w", layout.distro, err)
+		}
+		return layout, nil
+	}
+
+	for _, layout := range []linuxLayout{rhelLayout, debianLayout, archLayout} {
+		if lookPath(layout.refresh[0]) == nil {
+			return layout, nil
+		}
+	}
+	if len(ids) > 0 {
+		return linuxLayout{}, fmt.Errorf("unsupported Linux distribution %q: none of update-ca-trust, update-ca-certificates or trust found", ids[0])
+	}
+	return linuxLayout{}, fmt.Errorf("none of update-ca-trust, update-ca-certificates or trust found in PATH")
+}
+
+// osReleaseIDs returns the ID and ID_LIKE entries of /etc/os-release, most
+// specific first.
+func osReleaseIDs() []string {
+	data, err := os.ReadFile(hostPath("/etc/os-release"))
+	if err != nil {
+		return nil
+	}
+	var id, idLike string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"'`)
+		switch key {
+		case "ID":
+			id = value
+		case "ID_LIKE":
+			idLike = value
+		}
+	}
+	return append(strings.Fields(id), strings.Fields(idLike)...)
+}
+
+// anchorName is the file name of the root CA in an anchor directory. It is
+// derived from the fingerprint so it cannot collide with other tools.
+func anchorName(caCert *x509.Certificate) string {
+	return "apprecert-" + strings.ToLower(Fingerprint(caCert)[:16]) + ".crt"
+}
+
+// installAnchor writes the root CA into the layout's anchor directory and
+// rebuilds the trust store.
+func installAnchor(cfg *config.Config, layout linuxLayout) error {
+	certBytes, err := os.ReadFile(filepath.Join(cfg.CAROOT, "rootCA.pem"))
+	if err != nil {
+		return fmt.Errorf("failed to read certificate: %w", err)
+	}
+	caCert, err := cfg.LoadRootCert()
+	if err != nil {
 		return err
 	}
+	anchorDir := hostPath(layout.anchorDir)
+	anchor := filepath.Join(anchorDir, anchorName(caCert))
+	if state, _ := matchFile(anchor, caCert); state == StatePresent {
+		if legacy, _ := matchFile(filepath.Join(anchorDir, legacyAnchorFile), caCert); legacy != StatePresent {
+			return nil // Already installed
+		}
+	}
+	if err := CurrentRunner().WriteFile(anchor, certBytes, 0644, true); err != nil {
+		return err
+	}
+	if err := removeLegacyAnchor(anchorDir, caCert); err != nil {
+		return err
+	}
+
+	if err := recordRefresh(true, layout.refresh...); err != nil {
+		return err
+	}
+	if err := runCmd(true, layout.refresh[0], layout.refresh[1:]...); err != nil {
+		return fmt.Errorf("failed to update CA certificates: %w", err)
+	}
+	return nil
+}
 
-	cmd = exec.Command("sudo", "update-ca-certificates")
-	out, err := cmd.CombinedOutput()
+// uninstallAnchor removes the root CA, and anchors of earlier CAs with the
+// same subject, from the layout's anchor directory and rebuilds the trust
+// store.
+func uninstallAnchor(cfg *config.Config, layout linuxLayout) error {
+	caCert, err := cfg.LoadRootCert()
 	if err != nil {
-		return fmt.Errorf("failed to update CA certificates: %s", out)
+		return err
+	}
+	anchorDir := hostPath(layout.anchorDir)
+	if err := CurrentRunner().Remove(filepath.Join(anchorDir, anchorName(caCert)), true); err != nil {
+		return err
+	}
+	if err := removeLegacyAnchor(anchorDir, caCert); err != nil {
+		return err
+	}
+	if err := removeStaleAnchors(anchorDir, caCert); err != nil {
+		return err
+	}
+
+	if err := runCmd(true, layout.refresh[0], layout.refresh[1:]...); err != nil {
+		return fmt.Errorf("failed to remove CA certificates: %w", err)
 	}
 	return nil
 }
 
-func uninstallLinux(_ *config.Config) error {
-	cmd := exec.Command("sudo", "rm", "/usr/local/share/ca-certificates/rootCA.crt")
-	if err := cmd.Run(); err != nil {
+// removeLegacyAnchor removes an anchor written under the legacy name, but
+// only if it is our root CA and not another tool's.
+func removeLegacyAnchor(anchorDir string, caCert *x509.Certificate) error {
+	legacy := filepath.Join(anchorDir, legacyAnchorFile)
+	if state, err := matchFile(legacy, caCert); err != nil || state != StatePresent {
+		return nil
+	}
+	return CurrentRunner().Remove(legacy, true)
+}
+
+// removeStaleAnchors removes the apprecert anchors left by earlier CAs with
+// the same subject, e.g. one that was recreated with -force.
+func removeStaleAnchors(anchorDir string, caCert *x509.Certificate) error {
+	anchors, _ := filepath.Glob(filepath.Join(anchorDir, "apprecert-*.crt"))
+	for _, anchor := range anchors {
+		if state, err := matchFile(anchor, caCert); err != nil || state == StateAbsent {
+			continue
+		}
+		if err := CurrentRunner().Remove(anchor, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkAnchor reports whether the layout's anchor directory holds the root
+// CA, or a stale apprecert anchor from an older CA.
+func checkAnchor(store string, layout linuxLayout, caCert *x509.Certificate) ([]Status, error) {
+	anchorDir := hostPath(layout.anchorDir)
+	anchor := filepath.Join(anchorDir, anchorName(caCert))
+	others, _ := filepath.Glob(filepath.Join(anchorDir, "apprecert-*.crt"))
+
+	status := Status{Store: store, Location: anchor, State: StateAbsent}
+	for _, path := range append([]string{anchor, filepath.Join(anchorDir, legacyAnchorFile)}, others...) {
+		state, err := matchFile(path, caCert)
+		if err != nil {
+			return nil, err
+		}
+		if state == StatePresent {
+			return []Status{{Store: store, Location: path, State: StatePresent}}, nil
+		}
+		if state == StateStale && status.State == StateAbsent {
+			status = Status{Store: store, Location: path, State: StateStale}
+		}
+	}
+	return []Status{status}, nil
+}
+
+func installLinux(cfg *config.Config) error {
+	layout, err := detectLinux()
+	if err != nil {
 		return err
 	}
+	return installAnchor(cfg, layout)
+}
 
-	cmd = exec.Command("sudo", "update-ca-certificates")
-	out, err := cmd.CombinedOutput()
+func uninstallLinux(cfg *config.Config) error {
+	layout, err := detectLinux()
 	if err != nil {
-		return fmt.Errorf("failed to remove CA certificates: %s", out)
+		return err
 	}
-	return nil
+	return uninstallAnchor(cfg, layout)
+}
+
+// checkLinux looks for the root CA in the distribution's anchor directory.
+func checkLinux(caCert *x509.Certificate) ([]Status, error) {
+	layout, err := detectLinux()
+	if err != nil {
+		return nil, err
+	}
+	return checkAnchor("system", layout, caCert)
 }
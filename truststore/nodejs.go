@@ -1,29 +1,323 @@
 package truststore
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 
 	"github.com/appremon/apprecert/config"
+	"github.com/appremon/apprecert/utils"
 )
 
-// ConfigureNodeJS sets NODE_EXTRA_CA_CERTS to include the generated certificate.
+// nodeBundleFile is the combined bundle npm and yarn are pointed at. Unlike
+// NODE_EXTRA_CA_CERTS, their cafile options replace the default roots.
+const nodeBundleFile = "node-ca-bundle.pem"
+
+// windowsEnvKey is the registry key of the persistent user environment.
+const windowsEnvKey = `HKCU\Environment`
+
+// nodeConfig is a file through which a shell or package manager is pointed
+// at the root CA.
+type nodeConfig struct {
+	tool    string                   // the shell or package manager reading the file
+	path    string                   // the file holding the managed block
+	setting func(path string) string // the line pointing the tool at a CA file
+	key     string                   // for package managers, the option holding the CA file
+	ini     bool                     // the file has [sections] after its top-level options
+	active  bool                     // the tool is in use, so Install configures it
+}
+
+// nodeConfigs lists the shell profiles and package manager configs that
+// can point Node.js at the root CA: shells export NODE_EXTRA_CA_CERTS,
+// while npm (and pnpm, which reads .npmrc) and yarn get a cafile option.
+func nodeConfigs() []nodeConfig {
+	userHome, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	shell := filepath.Base(os.Getenv("SHELL"))
+	exportLine := func(path string) string {
+		return "export NODE_EXTRA_CA_CERTS=" + shellQuote([]string{path})
+	}
+
+	var configs []nodeConfig
+	if runtime.GOOS != "windows" {
+		bashrc := filepath.Join(userHome, ".bashrc")
+		if runtime.GOOS == "darwin" {
+			// Terminal windows on macOS start login shells
+			bashrc = filepath.Join(userHome, ".bash_profile")
+		}
+		zdotdir := os.Getenv("ZDOTDIR")
+		if zdotdir == "" {
+			zdotdir = userHome
+		}
+		configHome := os.Getenv("XDG_CONFIG_HOME")
+		if configHome == "" {
+			configHome = filepath.Join(userHome, ".config")
+		}
+		configs = append(configs,
+			nodeConfig{tool: "bash", path: bashrc, setting: exportLine},
+			nodeConfig{tool: "zsh", path: filepath.Join(zdotdir, ".zshrc"), setting: exportLine},
+			nodeConfig{tool: "fish", path: filepath.Join(configHome, "fish", "config.fish"), setting: func(path string) string {
+				return "set -gx NODE_EXTRA_CA_CERTS " + shellQuote([]string{path})
+			}},
+		)
+		for i := range configs {
+			configs[i].active = configs[i].tool == shell || utils.PathExists(configs[i].path)
+		}
+	}
+
+	yarnMajor := yarnMajorVersion()
+	return append(configs,
+		nodeConfig{tool: "npm", path: filepath.Join(userHome, ".npmrc"), key: "cafile", ini: true, active: true,
+			setting: func(path string) string { return "cafile=" + path }},
+		nodeConfig{tool: "yarn", path: filepath.Join(userHome, ".yarnrc"), key: "cafile",
+			active:  yarnMajor == "1" || utils.PathExists(filepath.Join(userHome, ".yarnrc")),
+			setting: func(path string) string { return "cafile " + strconv.Quote(path) }},
+		nodeConfig{tool: "yarn", path: filepath.Join(userHome, ".yarnrc.yml"), key: "httpsCaFilePath",
+			active:  (yarnMajor != "" && yarnMajor != "1") || utils.PathExists(filepath.Join(userHome, ".yarnrc.yml")),
+			setting: func(path string) string { return "httpsCaFilePath: " + strconv.Quote(path) }},
+	)
+}
+
+// yarnMajorVersion returns the major version of yarn on PATH, or "" if it
+// is not installed. Yarn 1 reads .yarnrc, later versions .yarnrc.yml.
+func yarnMajorVersion() string {
+	if lookPath("yarn") != nil {
+		return ""
+	}
+	out, err := query("yarn", "--version")
+	if err != nil {
+		return ""
+	}
+	major, _, _ := strings.Cut(strings.TrimSpace(string(out)), ".")
+	return major
+}
+
+// hasSetting reports whether key is set in data outside our managed block.
+func hasSetting(data []byte, key string) bool {
+	data, _ = utils.RemoveBlock(data)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, key) && len(line) > len(key) && strings.ContainsRune(" \t=:", rune(line[len(key)])) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigureNodeJS makes NODE_EXTRA_CA_CERTS point at the root CA in the
+// profiles of the shells in use (the user environment on Windows), and
+// points npm and yarn at a bundle of the system roots and the root CA. Each
+// setting is a managed block that UnconfigureNodeJS removes again.
 func ConfigureNodeJS(cfg *config.Config) error {
 	certPath := filepath.Join(cfg.CAROOT, "rootCA.pem")
 	if _, err := os.Stat(certPath); os.IsNotExist(err) {
 		return fmt.Errorf("certificate not found at %s", certPath)
 	}
 
-	os.Setenv("NODE_EXTRA_CA_CERTS", certPath)
+	var bundlePath string
+	shellUpdated := false
+	for _, c := range nodeConfigs() {
+		if !c.active {
+			continue
+		}
+		data, err := os.ReadFile(c.path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read %s: %w", c.path, err)
+		}
+		target := certPath
+		if c.key != "" {
+			if hasSetting(data, c.key) {
+				addNote("%s already sets %s, left unchanged", c.path, c.key)
+				continue
+			}
+			if bundlePath == "" {
+				roots, err := systemRoots()
+				if err != nil {
+					return err
+				}
+				if bundlePath, err = writeCombinedBundle(cfg, nodeBundleFile, roots); err != nil {
+					return err
+				}
+			}
+			target = bundlePath
+		}
+
+		if err := ensureDir(filepath.Dir(c.path)); err != nil {
+			return fmt.Errorf("failed to create %s: %w", filepath.Dir(c.path), err)
+		}
+		updated := utils.SetBlock(data, c.setting(target))
+		if c.ini {
+			updated = utils.SetINIBlock(data, c.setting(target))
+		}
+		changed, err := updateFile(c.path, data, updated, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", c.path, err)
+		}
+		if changed {
+			addNote("updated %s (%s)", c.path, c.tool)
+			shellUpdated = shellUpdated || c.key == ""
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		changed, err := setWindowsExtraCACerts(cfg, certPath)
+		if err != nil {
+			return err
+		}
+		shellUpdated = shellUpdated || changed
+	}
+	if shellUpdated {
+		addNote("open a new shell to pick up NODE_EXTRA_CA_CERTS")
+	}
 	return nil
 }
 
+// windowsEnvGet returns a variable of the persistent Windows user
+// environment, or "" if it is not set.
+func windowsEnvGet(name string) string {
+	out, err := query("reg", "query", windowsEnvKey, "/v", name)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.EqualFold(fields[0], name) || !strings.HasPrefix(fields[1], "REG_") {
+			continue
+		}
+		_, value, _ := strings.Cut(line, fields[1])
+		return strings.TrimSpace(value)
+	}
+	return ""
+}
+
+// setWindowsExtraCACerts sets NODE_EXTRA_CA_CERTS in the user environment
+// to certPath, journaling how to restore the current value. A value that is
+// not ours is kept in config.json for UnconfigureNodeJS.
+func setWindowsExtraCACerts(cfg *config.Config, certPath string) (bool, error) {
+	current := windowsEnvGet("NODE_EXTRA_CA_CERTS")
+	if strings.EqualFold(current, certPath) {
+		return false, nil
+	}
+	if out, err := CurrentRunner().Run(false, "setx", "NODE_EXTRA_CA_CERTS", certPath); err != nil {
+		return false, fmt.Errorf("failed to set NODE_EXTRA_CA_CERTS: %s", out)
+	}
+	undo := []string{"reg", "delete", windowsEnvKey, "/v", "NODE_EXTRA_CA_CERTS", "/f"}
+	if current != "" {
+		undo = []string{"setx", "NODE_EXTRA_CA_CERTS", current}
+	}
+	if err := recordUndo(false, undo...); err != nil {
+		return false, err
+	}
+	addNote("set NODE_EXTRA_CA_CERTS in the user environment")
+	if cfg.NodePreviousExtraCACerts == current {
+		return true, nil
+	}
+	if current != "" {
+		addNote("NODE_EXTRA_CA_CERTS was %s; it is restored on uninstall", current)
+	}
+	cfg.NodePreviousExtraCACerts = current
+	return true, saveConfig(cfg, "remember the previous NODE_EXTRA_CA_CERTS in config.json")
+}
+
+// UnconfigureNodeJS removes the settings made by ConfigureNodeJS.
 func UnconfigureNodeJS(cfg *config.Config) error {
-	// Clear the NODE_EXTRA_CA_CERTS environment variable
-	if err := os.Unsetenv("NODE_EXTRA_CA_CERTS"); err != nil {
-		return fmt.Errorf("failed to unset NODE_EXTRA_CA_CERTS: %w", err)
+	var errs []error
+	for _, c := range nodeConfigs() {
+		changed, err := clearBlock(c.path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to update %s: %w", c.path, err))
+		} else if changed {
+			addNote("removed from %s (%s)", c.path, c.tool)
+		}
 	}
 
-	return nil
-}
\ No newline at end of file
+	bundlePath := filepath.Join(cfg.CAROOT, nodeBundleFile)
+	if utils.PathExists(bundlePath) {
+		if err := CurrentRunner().Remove(bundlePath, false); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove %s: %w", bundlePath, err))
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		// Only undo our own value, restoring the one it replaced
+		certPath := filepath.Join(cfg.CAROOT, "rootCA.pem")
+		if strings.EqualFold(windowsEnvGet("NODE_EXTRA_CA_CERTS"), certPath) {
+			argv := []string{"reg", "delete", windowsEnvKey, "/v", "NODE_EXTRA_CA_CERTS", "/f"}
+			if cfg.NodePreviousExtraCACerts != "" {
+				argv = []string{"setx", "NODE_EXTRA_CA_CERTS", cfg.NodePreviousExtraCACerts}
+			}
+			if out, err := CurrentRunner().Run(false, argv[0], argv[1:]...); err != nil {
+				errs = append(errs, fmt.Errorf("failed to unset NODE_EXTRA_CA_CERTS: %s", out))
+			}
+		}
+		if len(errs) == 0 && cfg.NodePreviousExtraCACerts != "" {
+			cfg.NodePreviousExtraCACerts = ""
+			errs = append(errs, saveConfig(cfg, "forget the previous NODE_EXTRA_CA_CERTS in config.json"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// nodeJSStore points Node.js, npm and yarn at the root CA.
+type nodeJSStore struct{}
+
+func (nodeJSStore) Name() string { return "nodejs" }
+
+func (nodeJSStore) Detect(_ *config.Config) error { return lookPath("node") }
+
+func (nodeJSStore) Install(cfg *config.Config) error { return ConfigureNodeJS(cfg) }
+
+func (nodeJSStore) Uninstall(cfg *config.Config) error { return UnconfigureNodeJS(cfg) }
+
+func (nodeJSStore) Check(cfg *config.Config) ([]Status, error) {
+	caCert, err := cfg.LoadRootCert()
+	if err != nil {
+		return nil, err
+	}
+
+	certPath := filepath.Join(cfg.CAROOT, "rootCA.pem")
+	var statuses []Status
+	for _, c := range nodeConfigs() {
+		data, err := os.ReadFile(c.path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		_, _, installed := utils.FindBlock(data)
+		if !c.active && !installed {
+			continue
+		}
+		target := certPath
+		if c.key != "" {
+			target = filepath.Join(cfg.CAROOT, nodeBundleFile)
+		}
+		status := Status{Store: "nodejs", Location: c.path, State: StateAbsent}
+		switch {
+		case bytes.Contains(data, []byte(utils.ManagedBlock(c.setting(target)))):
+			if status.State, err = matchFile(target, caCert); err != nil {
+				return nil, err
+			}
+		case installed:
+			// Our block points at the CA of another CAROOT
+			status.State = StateStale
+		case c.key != "" && hasSetting(data, c.key):
+			status.Detail = c.key + " is set to another file"
+		}
+		statuses = append(statuses, status)
+	}
+
+	if runtime.GOOS == "windows" {
+		status := Status{Store: "nodejs", Location: windowsEnvKey, State: StateAbsent}
+		if strings.EqualFold(windowsEnvGet("NODE_EXTRA_CA_CERTS"), certPath) {
+			status.State = StatePresent
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
@@ -0,0 +1,82 @@
+package truststore_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appremon/apprecert/truststore"
+)
+
+func TestNodeJSInstallUninstall(t *testing.T) {
+	e := newEnv(t)
+	roots := e.systemRoots(t)
+	t.Setenv("SHELL", "/bin/bash")
+	e.r.Provide("node")
+	bashrc := filepath.Join(e.home, ".bashrc")
+	const profile = "alias ll='ls -l'\n"
+	writeFile(t, bashrc, []byte(profile))
+	npmrc := filepath.Join(e.home, ".npmrc")
+	const npmSettings = "registry=https://registry.npmjs.org/\n\n[scope]\nkey=value\n"
+	writeFile(t, npmrc, []byte(npmSettings))
+
+	e.install(t, "nodejs")
+	certPath := filepath.Join(e.cfg.CAROOT, "rootCA.pem")
+	if data := readFile(t, bashrc); !strings.HasPrefix(data, profile) || !strings.Contains(data, "export NODE_EXTRA_CA_CERTS="+certPath) {
+		t.Fatalf(".bashrc after install:\n%s", data)
+	}
+	nodeBundle := filepath.Join(e.cfg.CAROOT, "node-ca-bundle.pem")
+	data := readFile(t, npmrc)
+	if i := strings.Index(data, "cafile="+nodeBundle); i < 0 || i > strings.Index(data, "[scope]") {
+		t.Fatalf(".npmrc after install, want cafile before the first section:\n%s", data)
+	}
+	if data := readFile(t, nodeBundle); !strings.HasPrefix(data, roots) || !strings.Contains(data, string(rootPEM(t, e.cfg))) {
+		t.Fatalf("npm bundle after install:\n%s", data)
+	}
+	report, err := truststore.Check(e.cfg, truststore.Selection{Only: []string{"nodejs"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range report.Statuses {
+		if status.State != truststore.StatePresent {
+			t.Errorf("%s is %s after install, want present", status.Location, status.State)
+		}
+	}
+	e.reinstall(t, "nodejs")
+
+	e.uninstall(t, "nodejs")
+	if data := readFile(t, bashrc); data != profile {
+		t.Fatalf(".bashrc after uninstall:\n%s", data)
+	}
+	if data := readFile(t, npmrc); data != npmSettings {
+		t.Fatalf(".npmrc after uninstall:\n%s", data)
+	}
+	if _, err := os.Stat(nodeBundle); !os.IsNotExist(err) {
+		t.Fatal("npm bundle left after uninstall")
+	}
+}
+
+func TestNodeJSKeepsUserCafile(t *testing.T) {
+	e := newEnv(t)
+	e.systemRoots(t)
+	e.r.Provide("node")
+	npmrc := filepath.Join(e.home, ".npmrc")
+	const npmSettings = "cafile=/etc/corp-ca.pem\n"
+	writeFile(t, npmrc, []byte(npmSettings))
+
+	results := e.install(t, "nodejs")
+	if data := readFile(t, npmrc); data != npmSettings {
+		t.Fatalf(".npmrc changed although cafile was set:\n%s", data)
+	}
+	if notes := strings.Join(results[0].Notes, "\n"); !strings.Contains(notes, "already sets cafile") {
+		t.Fatalf("notes %q, want a note about the existing cafile", notes)
+	}
+}
+
+func TestNodeJSNotInstalled(t *testing.T) {
+	e := newEnv(t)
+	if _, err := truststore.Install(e.cfg, truststore.Selection{Only: []string{"nodejs"}}); err == nil {
+		t.Fatal("Install succeeded without node")
+	}
+}
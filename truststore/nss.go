@@ -1,9 +1,10 @@
 package truststore
 
 import (
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -52,23 +53,100 @@ func FindNSSProfiles() ([]NSSProfile, error) {
 
 // Install adds the CA certificate to the NSS trust store.
 func (n *NSSProfile) Install(cfg *config.Config) error {
+	caCert, err := cfg.LoadRootCert()
+	if err != nil {
+		return err
+	}
+	if n.state(caCert) == StatePresent {
+		return nil // Already installed
+	}
 	certPath := filepath.Join(cfg.CAROOT, "rootCA.pem")
-	cmd := exec.Command(n.CertutilCmd, "-A", "-d", "sql:"+n.Path,
+	output, err := CurrentRunner().Run(false, n.CertutilCmd, "-A", "-d", "sql:"+n.Path,
 		"-t", "C,,", "-n", "apprecert-rootCA", "-i", certPath,
 	)
-	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("failed to install certificate in NSS trust store (%s): %s", n.Path, output)
 	}
-	return nil
+	return recordUndo(false, n.CertutilCmd, "-D", "-d", "sql:"+n.Path, "-n", "apprecert-rootCA")
+}
+
+// state reports whether caCert is trusted under our nickname.
+func (n *NSSProfile) state(caCert *x509.Certificate) State {
+	out, err := query(n.CertutilCmd, "-L", "-d", "sql:"+n.Path, "-n", "apprecert-rootCA", "-a")
+	if err != nil {
+		return StateAbsent
+	}
+	// Anything else under our nickname is a leftover from an older CA
+	if state := matchPEM(out, caCert); state == StatePresent {
+		return state
+	}
+	return StateStale
 }
 
 // Uninstall removes the CA certificate from the NSS trust store.
 func (n *NSSProfile) Uninstall() error {
-	cmd := exec.Command(n.CertutilCmd, "-D", "-d", "sql:"+n.Path, "-n", "apprecert-rootCA")
-	output, err := cmd.CombinedOutput()
+	output, err := CurrentRunner().Run(false, n.CertutilCmd, "-D", "-d", "sql:"+n.Path, "-n", "apprecert-rootCA")
 	if err != nil && !strings.Contains(string(output), "could not be found") {
 		return fmt.Errorf("failed to remove certificate from NSS trust store (%s): %s", n.Path, output)
 	}
 	return nil
 }
+
+// nssStore covers every NSS database found by FindNSSProfiles.
+type nssStore struct{}
+
+func (nssStore) Name() string { return "nss" }
+
+func (nssStore) Detect(_ *config.Config) error {
+	if err := lookPath("certutil"); err != nil {
+		return err
+	}
+	profiles, err := FindNSSProfiles()
+	if err != nil {
+		return err
+	}
+	if len(profiles) == 0 {
+		return fmt.Errorf("no NSS databases found")
+	}
+	return nil
+}
+
+func (nssStore) Install(cfg *config.Config) error {
+	profiles, err := FindNSSProfiles()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, profile := range profiles {
+		errs = append(errs, profile.Install(cfg))
+	}
+	return errors.Join(errs...)
+}
+
+func (nssStore) Uninstall(_ *config.Config) error {
+	profiles, err := FindNSSProfiles()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, profile := range profiles {
+		errs = append(errs, profile.Uninstall())
+	}
+	return errors.Join(errs...)
+}
+
+func (nssStore) Check(cfg *config.Config) ([]Status, error) {
+	caCert, err := cfg.LoadRootCert()
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := FindNSSProfiles()
+	if err != nil {
+		return nil, err
+	}
+	var statuses []Status
+	for _, profile := range profiles {
+		statuses = append(statuses, Status{Store: "nss", Location: profile.Path, State: profile.state(caCert)})
+	}
+	return statuses, nil
+}
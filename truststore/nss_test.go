@@ -0,0 +1,105 @@
+package truststore_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appremon/apprecert/truststore"
+	"github.com/appremon/apprecert/truststore/trusttest"
+)
+
+// nssDB creates an empty NSS database in the fake home and returns its
+// certutil -d argument.
+func (e *env) nssDB(t *testing.T) string {
+	t.Helper()
+	dir := filepath.Join(e.home, ".pki", "nssdb")
+	writeFile(t, filepath.Join(dir, "cert9.db"), nil)
+	return "sql:" + dir
+}
+
+func TestNSSInstallUninstall(t *testing.T) {
+	e := newEnv(t)
+	db := e.nssDB(t)
+	e.r.Provide("certutil").
+		On(trusttest.Response{Stderr: "could not find cert", ExitCode: 255}, "certutil", "-L")
+
+	e.install(t, "nss")
+	certPath := filepath.Join(e.cfg.CAROOT, "rootCA.pem")
+	want := "certutil -A -d " + db + " -t C,, -n apprecert-rootCA -i " + certPath
+	if cmds := e.r.Commands(); len(cmds) != 1 || cmds[0] != want {
+		t.Fatalf("commands %q, want [%s]", cmds, want)
+	}
+
+	// certutil now lists the certificate under our nickname
+	e.r.On(trusttest.Response{Stdout: string(rootPEM(t, e.cfg))}, "certutil", "-L")
+	if state := e.state(t, "nss"); state != truststore.StatePresent {
+		t.Fatalf("state %s after install, want present", state)
+	}
+	e.reinstall(t, "nss")
+
+	e.r.Reset()
+	e.uninstall(t, "nss")
+	want = "certutil -D -d " + db + " -n apprecert-rootCA"
+	if cmds := e.r.Commands(); len(cmds) != 1 || cmds[0] != want {
+		t.Fatalf("commands %q, want [%s]", cmds, want)
+	}
+}
+
+func TestNSSReplacesStaleCertificate(t *testing.T) {
+	e := newEnv(t)
+	e.nssDB(t)
+	e.r.Provide("certutil").
+		On(trusttest.Response{Stdout: string(rootPEM(t, newCA(t)))}, "certutil", "-L")
+
+	if state := e.state(t, "nss"); state != truststore.StateStale {
+		t.Fatalf("state %s with an older CA under our nickname, want stale", state)
+	}
+	e.install(t, "nss")
+	if !hasCommand(e.r, "certutil -A") {
+		t.Fatalf("stale certificate not replaced: %q", e.r.Commands())
+	}
+}
+
+func TestNSSCertutilFailure(t *testing.T) {
+	e := newEnv(t)
+	e.nssDB(t)
+	e.r.Provide("certutil").
+		On(trusttest.Response{ExitCode: 255}, "certutil", "-L").
+		On(trusttest.Response{Stderr: "SEC_ERROR_READ_ONLY", ExitCode: 1}, "certutil", "-A")
+
+	results, err := truststore.Install(e.cfg, truststore.Selection{Only: []string{"nss"}})
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if err := results.Err(); err == nil || !strings.Contains(err.Error(), "SEC_ERROR_READ_ONLY") {
+		t.Fatalf("Install: got %v, want the certutil error", err)
+	}
+	// Nothing was added, so there is nothing to delete on rollback
+	if hasCommand(e.r, "certutil -D") {
+		t.Fatalf("rollback deleted a certificate that was not added: %q", e.r.Commands())
+	}
+}
+
+func TestNSSUninstallToleratesMissingCertificate(t *testing.T) {
+	e := newEnv(t)
+	e.nssDB(t)
+	e.r.Provide("certutil").
+		On(trusttest.Response{Stderr: "certutil: could not find certificate named \"apprecert-rootCA\": could not be found", ExitCode: 255}, "certutil", "-D")
+	e.uninstall(t, "nss")
+}
+
+func TestNSSUninstallFailure(t *testing.T) {
+	e := newEnv(t)
+	e.nssDB(t)
+	e.r.Provide("certutil").
+		On(trusttest.Response{Stderr: "SEC_ERROR_BAD_DATABASE", ExitCode: 1}, "certutil", "-D")
+
+	results, err := truststore.Uninstall(e.cfg, truststore.Selection{Only: []string{"nss"}})
+	if err != nil {
+		t.Fatalf("Uninstall: %v", err)
+	}
+	if err := results.Err(); err == nil || !strings.Contains(err.Error(), "SEC_ERROR_BAD_DATABASE") {
+		t.Fatalf("Uninstall: got %v, want the certutil error", err)
+	}
+}
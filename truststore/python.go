@@ -2,54 +2,321 @@ package truststore
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strings"
 
 	"github.com/appremon/apprecert/config"
+	"github.com/appremon/apprecert/utils"
 )
 
-// AppendToCertifi appends the certificate to the certifi bundle used by Python.
+// pipBundleFile is the combined bundle pip is pointed at in pip.conf mode.
+const pipBundleFile = "pip-ca-bundle.pem"
+
+// AppendToCertifi adds the certificate to every certifi bundle used by
+// Python, inside a managed block so RemoveFromCertifi can take it out again.
 func AppendToCertifi(cfg *config.Config) error {
-	certPath := filepath.Join(cfg.CAROOT, "rootCA.pem")
-	certifiBundlePath := findCertifiBundle()
-	if certifiBundlePath == "" {
+	certBytes, err := os.ReadFile(filepath.Join(cfg.CAROOT, "rootCA.pem"))
+	if err != nil {
+		return fmt.Errorf("failed to read certificate: %w", err)
+	}
+	bundles := FindCertifiBundles()
+	if len(bundles) == 0 {
 		return fmt.Errorf("could not locate certifi bundle")
 	}
 
-	certBytes, err := os.ReadFile(certPath)
-	if err != nil {
-		return fmt.Errorf("failed to read certificate: %w", err)
+	var errs []error
+	for _, path := range bundles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read certifi bundle: %w", err))
+			continue
+		}
+		// Older versions appended the certificate without markers
+		updated, _ := utils.RemoveBlock(data)
+		updated = utils.SetBlock(bytes.Replace(updated, certBytes, nil, -1), string(certBytes))
+		if _, err := updateFile(path, data, updated, 0644); err != nil {
+			errs = append(errs, fmt.Errorf("failed to update certifi bundle %s: %w", path, err))
+		}
 	}
+	return errors.Join(errs...)
+}
 
-	bundleBytes, err := os.ReadFile(certifiBundlePath)
+// RemoveFromCertifi removes the certificate from every certifi bundle used by Python.
+func RemoveFromCertifi(cfg *config.Config) error {
+	certBytes, err := os.ReadFile(filepath.Join(cfg.CAROOT, "rootCA.pem"))
 	if err != nil {
-		return fmt.Errorf("failed to read certifi bundle: %w", err)
+		return fmt.Errorf("failed to read certificate: %w", err)
 	}
 
-	if bytes.Contains(bundleBytes, certBytes) {
-		return nil // Already appended
+	var errs []error
+	for _, path := range FindCertifiBundles() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read certifi bundle: %w", err))
+			continue
+		}
+		updated, _ := utils.RemoveBlock(data)
+		updated = bytes.Replace(updated, certBytes, nil, -1)
+		if _, err := updateFile(path, data, updated, 0644); err != nil {
+			errs = append(errs, fmt.Errorf("failed to update certifi bundle %s: %w", path, err))
+		}
 	}
+	return errors.Join(errs...)
+}
 
-	err = os.WriteFile(certifiBundlePath, append(bundleBytes, certBytes...), 0644)
-	if err != nil {
-		return fmt.Errorf("failed to update certifi bundle: %w", err)
+// FindCertifiBundles locates the certifi bundles of the Python interpreters
+// and environments on the machine, including the copies vendored by pip.
+// Bundles that certifi redirects to the system store, as on Debian and
+// Fedora, are left to the system store and not returned.
+func FindCertifiBundles() []string {
+	var bundles []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil || filepath.Base(resolved) != "cacert.pem" || seen[resolved] {
+			return
+		}
+		seen[resolved] = true
+		bundles = append(bundles, path)
 	}
 
-	return nil
+	if path := findCertifiBundle(); path != "" {
+		add(path)
+	}
+	for _, prefix := range pythonPrefixes() {
+		for _, pattern := range []string{
+			"lib/python3*/site-packages",
+			"lib/python3*/dist-packages",
+			"Lib/site-packages",
+		} {
+			for _, pkg := range []string{"certifi", "pip/_vendor/certifi"} {
+				matches, _ := filepath.Glob(filepath.Join(prefix, pattern, pkg, "cacert.pem"))
+				for _, path := range matches {
+					add(path)
+				}
+			}
+		}
+	}
+	return bundles
 }
 
-// findCertifiBundle locates the certifi bundle path.
+// findCertifiBundle asks python3 on PATH for its certifi bundle.
 func findCertifiBundle() string {
-	pythonPath, err := exec.LookPath("python3")
+	pythonPath, err := CurrentRunner().LookPath("python3")
 	if err != nil {
 		return ""
 	}
-	cmd := exec.Command(pythonPath, "-m", "certifi")
-	output, err := cmd.Output()
+	output, err := query(pythonPath, "-m", "certifi")
 	if err != nil {
 		return ""
 	}
 	return string(bytes.TrimSpace(output))
 }
+
+// pythonPrefixes lists candidate Python installations and environments:
+// the active virtualenv or conda environment, project virtualenvs in the
+// working directory, system prefixes, and those managed by virtualenvwrapper,
+// pyenv, conda, uv and pipx.
+func pythonPrefixes() []string {
+	var prefixes []string
+	for _, env := range []string{"VIRTUAL_ENV", "CONDA_PREFIX"} {
+		if prefix := os.Getenv(env); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if wd, err := os.Getwd(); err == nil {
+		prefixes = append(prefixes, filepath.Join(wd, ".venv"), filepath.Join(wd, "venv"))
+	}
+
+	patterns := []string{
+		hostPath("/usr"),
+		hostPath("/usr/local"),
+		hostPath("/opt/conda"),
+		hostPath("/opt/conda/envs/*"),
+	}
+	if workon := os.Getenv("WORKON_HOME"); workon != "" {
+		patterns = append(patterns, filepath.Join(workon, "*"))
+	}
+	if userHome, err := os.UserHomeDir(); err == nil {
+		patterns = append(patterns,
+			filepath.Join(userHome, ".local"),
+			filepath.Join(userHome, ".virtualenvs/*"),
+			filepath.Join(userHome, ".pyenv/versions/*"),
+			filepath.Join(userHome, ".pyenv/versions/*/envs/*"),
+			filepath.Join(userHome, ".local/share/uv/python/*"),
+			filepath.Join(userHome, ".local/share/uv/tools/*"),
+			filepath.Join(userHome, ".local/share/pipx/venvs/*"),
+		)
+		for _, conda := range []string{"miniconda3", "anaconda3", "miniforge3", "mambaforge"} {
+			patterns = append(patterns,
+				filepath.Join(userHome, conda),
+				filepath.Join(userHome, conda, "envs/*"),
+			)
+		}
+	}
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(pattern)
+		prefixes = append(prefixes, matches...)
+	}
+	return prefixes
+}
+
+// pipConfPath returns the per-user pip configuration file.
+func pipConfPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(dir, "pip", "pip.ini"), nil
+	}
+	return filepath.Join(dir, "pip", "pip.conf"), nil
+}
+
+// ConfigurePip points pip at a bundle of the system roots and the root CA
+// through the cert option of pip.conf, leaving the certifi bundles alone.
+func ConfigurePip(cfg *config.Config) error {
+	roots, err := systemRoots()
+	if err != nil {
+		return err
+	}
+	bundlePath, err := writeCombinedBundle(cfg, pipBundleFile, roots)
+	if err != nil {
+		return err
+	}
+	confPath, err := pipConfPath()
+	if err != nil {
+		return fmt.Errorf("failed to locate pip.conf: %w", err)
+	}
+	data, err := os.ReadFile(confPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", confPath, err)
+	}
+	updated, err := setPipCert(data, bundlePath)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", confPath, err)
+	}
+	if err := ensureDir(filepath.Dir(confPath)); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(confPath), err)
+	}
+	if _, err := updateFile(confPath, data, updated, 0644); err != nil {
+		return fmt.Errorf("failed to update %s: %w", confPath, err)
+	}
+	addNote("pip uses %s (set in %s)", bundlePath, confPath)
+	addNote("for requests and other clients, export REQUESTS_CA_BUNDLE=%s", bundlePath)
+	return nil
+}
+
+// UnconfigurePip removes the cert option from pip.conf and deletes the bundle.
+func UnconfigurePip(cfg *config.Config) error {
+	confPath, err := pipConfPath()
+	if err != nil {
+		return fmt.Errorf("failed to locate pip.conf: %w", err)
+	}
+	if _, err := clearBlock(confPath); err != nil {
+		return fmt.Errorf("failed to update %s: %w", confPath, err)
+	}
+	bundlePath := filepath.Join(cfg.CAROOT, pipBundleFile)
+	if utils.PathExists(bundlePath) {
+		if err := CurrentRunner().Remove(bundlePath, false); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", bundlePath, err)
+		}
+	}
+	return nil
+}
+
+// setPipCert sets the cert option in the [global] section of a pip.conf to
+// bundlePath. pip rejects duplicate sections and options, so the managed
+// block goes right after an existing [global] header, and a cert option the
+// user set is left for them to change.
+func setPipCert(data []byte, bundlePath string) ([]byte, error) {
+	data, _ = utils.RemoveBlock(data)
+	header := -1 // end of the [global] header line
+	inGlobal := false
+	for offset := 0; offset < len(data); {
+		next := utils.LineEnd(data, offset)
+		line := strings.TrimSpace(string(data[offset:next]))
+		if strings.HasPrefix(line, "[") {
+			inGlobal = line == "[global]"
+			if inGlobal && header < 0 {
+				header = next
+			}
+		} else if i := strings.IndexAny(line, "=:"); inGlobal && i > 0 && strings.TrimSpace(line[:i]) == "cert" {
+			return nil, fmt.Errorf("cert is already set in [global]; remove it or add the root CA to that bundle")
+		}
+		offset = next
+	}
+
+	option := "cert = " + bundlePath
+	if header < 0 {
+		return utils.SetBlock(data, "[global]\n"+option), nil
+	}
+	return utils.SpliceBlock(data, header, header, option), nil
+}
+
+// pythonStore is the certifi CA bundles used by Python's requests and pip,
+// or with cfg.PythonPipConf, pip.conf.
+type pythonStore struct{}
+
+func (pythonStore) Name() string { return "python" }
+
+func (pythonStore) Detect(cfg *config.Config) error {
+	if cfg.PythonPipConf {
+		if lookPath("pip3") != nil {
+			return lookPath("pip")
+		}
+		return nil
+	}
+	if len(FindCertifiBundles()) == 0 {
+		return fmt.Errorf("no certifi bundle found (python3, virtualenvs, pyenv, conda, uv or pipx)")
+	}
+	return nil
+}
+
+func (pythonStore) Install(cfg *config.Config) error {
+	if cfg.PythonPipConf {
+		return ConfigurePip(cfg)
+	}
+	return AppendToCertifi(cfg)
+}
+
+// Uninstall undoes both modes, so switching modes leaves nothing behind.
+func (pythonStore) Uninstall(cfg *config.Config) error {
+	return errors.Join(RemoveFromCertifi(cfg), UnconfigurePip(cfg))
+}
+
+func (pythonStore) Check(cfg *config.Config) ([]Status, error) {
+	caCert, err := cfg.LoadRootCert()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.PythonPipConf {
+		confPath, err := pipConfPath()
+		if err != nil {
+			return nil, err
+		}
+		state := StateAbsent
+		if data, err := os.ReadFile(confPath); err == nil {
+			if _, _, ok := utils.FindBlock(data); ok {
+				if state, err = matchFile(filepath.Join(cfg.CAROOT, pipBundleFile), caCert); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return []Status{{Store: "python", Location: confPath, State: state}}, nil
+	}
+
+	var statuses []Status
+	for _, path := range FindCertifiBundles() {
+		status := Status{Store: "python", Location: path}
+		if status.State, err = matchFile(path, caCert); err != nil {
+			status.State, status.Detail = StateUnknown, err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
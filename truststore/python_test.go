@@ -0,0 +1,110 @@
+package truststore_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appremon/apprecert/truststore"
+)
+
+// certifiBundle creates a certifi bundle in the user site-packages of the
+// fake home and returns its path.
+func (e *env) certifiBundle(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(e.home, ".local", "lib", "python3.12", "site-packages", "certifi", "cacert.pem")
+	writeFile(t, path, []byte(contents))
+	return path
+}
+
+func TestPythonCertifiInstallUninstall(t *testing.T) {
+	e := newEnv(t)
+	const original = "# certifi roots\n"
+	bundle := e.certifiBundle(t, original)
+
+	e.install(t, "python")
+	data := readFile(t, bundle)
+	if !strings.HasPrefix(data, original) || !strings.Contains(data, string(rootPEM(t, e.cfg))) {
+		t.Fatalf("bundle after install:\n%s", data)
+	}
+	if state := e.state(t, "python"); state != truststore.StatePresent {
+		t.Fatalf("state %s after install, want present", state)
+	}
+	e.reinstall(t, "python")
+
+	e.uninstall(t, "python")
+	if data := readFile(t, bundle); data != original {
+		t.Fatalf("bundle after uninstall:\n%s", data)
+	}
+}
+
+func TestPythonCertifiMigratesUnmarkedCertificate(t *testing.T) {
+	e := newEnv(t)
+	// Older versions appended the certificate without markers
+	bundle := e.certifiBundle(t, "# certifi roots\n"+string(rootPEM(t, e.cfg)))
+
+	e.install(t, "python")
+	if n := strings.Count(readFile(t, bundle), "BEGIN CERTIFICATE"); n != 1 {
+		t.Fatalf("bundle holds the root CA %d times, want once", n)
+	}
+}
+
+func TestPythonNoBundle(t *testing.T) {
+	e := newEnv(t)
+	if _, err := truststore.Install(e.cfg, truststore.Selection{Only: []string{"python"}}); err == nil {
+		t.Fatal("Install succeeded without a certifi bundle")
+	}
+}
+
+func TestPythonPipConfInstallUninstall(t *testing.T) {
+	e := newEnv(t)
+	roots := e.systemRoots(t)
+	certifi := e.certifiBundle(t, "# certifi roots\n")
+	e.r.Provide("pip3")
+	e.cfg.PythonPipConf = true
+
+	e.install(t, "python")
+	pipConf := filepath.Join(e.home, ".config", "pip", "pip.conf")
+	pipBundle := filepath.Join(e.cfg.CAROOT, "pip-ca-bundle.pem")
+	if data := readFile(t, pipConf); !strings.Contains(data, "[global]") || !strings.Contains(data, "cert = "+pipBundle) {
+		t.Fatalf("pip.conf after install:\n%s", data)
+	}
+	if data := readFile(t, pipBundle); !strings.HasPrefix(data, roots) || !strings.Contains(data, string(rootPEM(t, e.cfg))) {
+		t.Fatalf("pip bundle after install:\n%s", data)
+	}
+	if readFile(t, certifi) != "# certifi roots\n" {
+		t.Fatal("certifi bundle changed in pip.conf mode")
+	}
+	if state := e.state(t, "python"); state != truststore.StatePresent {
+		t.Fatalf("state %s after install, want present", state)
+	}
+	e.reinstall(t, "python")
+
+	e.uninstall(t, "python")
+	if _, err := os.Stat(pipConf); !os.IsNotExist(err) {
+		t.Fatalf("pip.conf left after uninstall:\n%s", readFile(t, pipConf))
+	}
+	if _, err := os.Stat(pipBundle); !os.IsNotExist(err) {
+		t.Fatal("pip bundle left after uninstall")
+	}
+}
+
+func TestPythonPipConfKeepsUserSettings(t *testing.T) {
+	e := newEnv(t)
+	e.systemRoots(t)
+	e.r.Provide("pip3")
+	e.cfg.PythonPipConf = true
+	pipConf := filepath.Join(e.home, ".config", "pip", "pip.conf")
+	const original = "[global]\ntimeout = 60\n"
+	writeFile(t, pipConf, []byte(original))
+
+	e.install(t, "python")
+	if data := readFile(t, pipConf); !strings.Contains(data, "timeout = 60") || !strings.Contains(data, "cert = ") {
+		t.Fatalf("pip.conf after install:\n%s", data)
+	}
+	e.uninstall(t, "python")
+	if data := readFile(t, pipConf); data != original {
+		t.Fatalf("pip.conf after uninstall:\n%s", data)
+	}
+}
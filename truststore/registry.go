@@ -0,0 +1,66 @@
+package truststore
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   []Store
+)
+
+func init() {
+	// Built-in stores, in installation order
+	for _, s := range []Store{
+		systemStore{},
+		kubernetesStore{},
+		dockerStore{},
+		gitStore{},
+		nodeJSStore{},
+		javaStore{},
+		nssStore{},
+		pythonStore{},
+	} {
+		Register(s)
+	}
+}
+
+// Register adds a store to the registry. Stores are installed in the order
+// they are registered. Register panics if a store with the same name exists.
+func Register(s Store) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, existing := range registry {
+		if existing.Name() == s.Name() {
+			panic(fmt.Sprintf("truststore: store %q registered twice", s.Name()))
+		}
+	}
+	registry = append(registry, s)
+}
+
+// Stores returns all registered stores in registration order.
+func Stores() []Store {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return append([]Store(nil), registry...)
+}
+
+// Lookup returns the registered store with the given name.
+func Lookup(name string) (Store, bool) {
+	for _, s := range Stores() {
+		if s.Name() == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// StoreNames returns the names of all registered stores.
+func StoreNames() []string {
+	var names []string
+	for _, s := range Stores() {
+		names = append(names, s.Name())
+	}
+	return names
+}
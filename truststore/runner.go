@@ -0,0 +1,226 @@
+package truststore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/appremon/apprecert/utils"
+)
+
+// Runner performs the system changes of the trust stores. Every command,
+// file write and other side effect goes through it, so it can be replaced,
+// e.g. by a Recorder for a dry run.
+type Runner interface {
+	// Run executes a command that changes the system and returns its
+	// combined output. With sudo, it runs as root.
+	Run(sudo bool, name string, args ...string) ([]byte, error)
+	// Query executes a read-only command and returns its standard output.
+	// It runs even in a dry run, as stores need it to decide what to do.
+	Query(name string, args ...string) ([]byte, error)
+	// LookPath searches PATH for a command, like exec.LookPath.
+	LookPath(file string) (string, error)
+	// WriteFile replaces the contents of a file. With sudo, it writes as root.
+	WriteFile(path string, data []byte, perm os.FileMode, sudo bool) error
+	// Remove deletes a file or an empty directory; a missing one is not an
+	// error. With sudo, it removes as root.
+	Remove(path string, sudo bool) error
+	// Apply performs a change that is not a command or file, such as a
+	// Windows API call, described by action.
+	Apply(action string, fn func() error) error
+}
+
+var (
+	runnerMu sync.Mutex
+	runner   Runner = execRunner{}
+	rootDir         = "/"
+)
+
+// SetRunner replaces the Runner used by all stores and returns the previous one.
+func SetRunner(r Runner) Runner {
+	runnerMu.Lock()
+	defer runnerMu.Unlock()
+	prev := runner
+	runner = r
+	return prev
+}
+
+// CurrentRunner returns the Runner stores make their changes through.
+func CurrentRunner() Runner {
+	runnerMu.Lock()
+	defer runnerMu.Unlock()
+	return runner
+}
+
+// SetRoot makes the stores resolve system paths, such as the Linux anchor
+// directory, under dir instead of "/" and returns the previous root. It lets
+// tests and image builds work on a directory tree without root privileges.
+func SetRoot(dir string) string {
+	runnerMu.Lock()
+	defer runnerMu.Unlock()
+	prev := rootDir
+	rootDir = dir
+	return prev
+}
+
+// hostPath resolves an absolute system path under the current root.
+func hostPath(path string) string {
+	runnerMu.Lock()
+	defer runnerMu.Unlock()
+	return filepath.Join(rootDir, path)
+}
+
+// needsRoot reports whether the user lacks permission to write path, so it
+// must be written through sudo.
+func needsRoot(path string) bool {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return os.IsPermission(err)
+	}
+	f.Close()
+	return false
+}
+
+// execRunner applies changes to the real system.
+type execRunner struct{}
+
+func (execRunner) Run(sudo bool, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	if sudo {
+		cmd = utils.CommandWithSudo(append([]string{name}, args...)...)
+	}
+	return cmd.CombinedOutput()
+}
+
+func (execRunner) Query(name string, args ...string) ([]byte, error) {
+	out, err := exec.Command(name, args...).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return out, fmt.Errorf("%s: %w", bytes.TrimSpace(exitErr.Stderr), err)
+	}
+	return out, err
+}
+
+func (execRunner) LookPath(file string) (string, error) { return exec.LookPath(file) }
+
+func (execRunner) WriteFile(path string, data []byte, perm os.FileMode, sudo bool) error {
+	if !sudo || os.Geteuid() == 0 {
+		if err := os.WriteFile(path, data, perm); err != nil {
+			return err
+		}
+		return os.Chmod(path, perm)
+	}
+	cmd := utils.CommandWithSudo("tee", path)
+	cmd.Stdin = bytes.NewReader(data)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w", bytes.TrimSpace(out), err)
+	}
+	return runCmd(true, "chmod", fmt.Sprintf("%04o", perm), path)
+}
+
+func (execRunner) Remove(path string, sudo bool) error {
+	if !sudo || os.Geteuid() == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return runCmd(true, "rmdir", path)
+	}
+	return runCmd(true, "rm", "-f", path)
+}
+
+func (execRunner) Apply(_ string, fn func() error) error { return fn() }
+
+// Recorder is a Runner that prints the changes it is asked to make instead
+// of making them. Read-only queries are still executed.
+type Recorder struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// NewRecorder returns a Recorder printing to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+func (r *Recorder) printf(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(r.w, format+"\n", args...)
+}
+
+func (r *Recorder) Run(sudo bool, name string, args ...string) ([]byte, error) {
+	argv := append([]string{name}, args...)
+	if sudo && os.Geteuid() != 0 {
+		argv = append([]string{"sudo"}, argv...)
+	}
+	r.printf("would run: %s", shellQuote(argv))
+	return nil, nil
+}
+
+func (r *Recorder) Query(name string, args ...string) ([]byte, error) {
+	return execRunner{}.Query(name, args...)
+}
+
+func (r *Recorder) LookPath(file string) (string, error) { return exec.LookPath(file) }
+
+func (r *Recorder) WriteFile(path string, data []byte, perm os.FileMode, sudo bool) error {
+	r.printf("would write: %s (%d bytes, mode %04o)%s", path, len(data), perm, sudoNote(sudo))
+	return nil
+}
+
+func (r *Recorder) Remove(path string, sudo bool) error {
+	r.printf("would remove: %s%s", path, sudoNote(sudo))
+	return nil
+}
+
+// sudoNote marks a recorded file change that is made as root.
+func sudoNote(sudo bool) string {
+	if sudo && os.Geteuid() != 0 {
+		return " as root"
+	}
+	return ""
+}
+
+func (r *Recorder) Apply(action string, _ func() error) error {
+	r.printf("would %s", action)
+	return nil
+}
+
+// shellQuote formats argv as a command line that can be pasted into a shell.
+func shellQuote(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\$`!*?[]{}()<>|&;#~") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+// runCmd runs a command through the current Runner, wrapping a failure
+// with the command's output.
+func runCmd(sudo bool, name string, args ...string) error {
+	out, err := CurrentRunner().Run(sudo, name, args...)
+	if err != nil {
+		if out = bytes.TrimSpace(out); len(out) > 0 {
+			return fmt.Errorf("%s: %w", out, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// query runs a read-only command through the current Runner.
+func query(name string, args ...string) ([]byte, error) {
+	return CurrentRunner().Query(name, args...)
+}
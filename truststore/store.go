@@ -0,0 +1,103 @@
+package truststore
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/appremon/apprecert/config"
+)
+
+// Store is a trust store the root CA can be installed into.
+type Store interface {
+	// Name identifies the store, e.g. "system" or "java".
+	Name() string
+	// Detect returns an error explaining why the store is not available on
+	// this machine, e.g. because its tooling is not installed.
+	Detect(cfg *config.Config) error
+	// Install adds the root CA to the store.
+	Install(cfg *config.Config) error
+	// Uninstall removes the root CA from the store.
+	Uninstall(cfg *config.Config) error
+	// Check reports whether the root CA is present in each location of the store.
+	Check(cfg *config.Config) ([]Status, error)
+}
+
+// State describes whether the root CA is present in a store location.
+type State string
+
+// Trust states reported by Check.
+const (
+	StatePresent State = "present"
+	StateAbsent  State = "absent"
+	StateStale   State = "stale" // a different certificate under our alias
+
+	// States reported by the top-level Check only.
+	StateUnavailable State = "unavailable" // the store was not detected
+	StateUnknown     State = "unknown"     // inspecting the store failed
+)
+
+// Status is the state of the root CA in one location of a store, e.g. one
+// NSS database or one Java cacerts file.
+type Status struct {
+	Store    string `json:"store"`
+	Location string `json:"location,omitempty"`
+	State    State  `json:"state"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// Result is the outcome of installing or uninstalling one store.
+type Result struct {
+	Store      string
+	Skipped    bool  // the store was not detected; Err says why
+	Err        error // why the store was skipped or failed
+	RolledBack bool  // another store failed, so the changes were reverted
+
+	// Notes tell the user what the store changed or what is left to do,
+	// e.g. which shell profiles were updated.
+	Notes []string
+}
+
+// Results collects the outcome for every store.
+type Results []Result
+
+// Err joins the errors of all stores that failed, ignoring skipped ones.
+func (r Results) Err() error {
+	var errs []error
+	for _, res := range r {
+		if !res.Skipped && res.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", res.Store, res.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// lookPath reports whether a command is available.
+func lookPath(name string) error {
+	if _, err := CurrentRunner().LookPath(name); err != nil {
+		return fmt.Errorf("%s not found in PATH", name)
+	}
+	return nil
+}
+
+var (
+	notesMu sync.Mutex
+	notes   []string
+)
+
+// addNote adds a note to the Result of the store being installed or
+// uninstalled.
+func addNote(format string, args ...interface{}) {
+	notesMu.Lock()
+	defer notesMu.Unlock()
+	notes = append(notes, fmt.Sprintf(format, args...))
+}
+
+// takeNotes returns and clears the notes added so far.
+func takeNotes() []string {
+	notesMu.Lock()
+	defer notesMu.Unlock()
+	taken := notes
+	notes = nil
+	return taken
+}
@@ -0,0 +1,66 @@
+package truststore
+
+import (
+	"crypto/x509"
+	"fmt"
+	"runtime"
+
+	"github.com/appremon/apprecert/config"
+)
+
+// systemStore is the operating system trust store.
+type systemStore struct{}
+
+func (systemStore) Name() string { return "system" }
+
+func (systemStore) Detect(_ *config.Config) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return lookPath("security")
+	case "linux":
+		_, err := detectLinux()
+		return err
+	case "windows":
+		return nil
+	default:
+		return fmt.Errorf("unsupported platform %s", runtime.GOOS)
+	}
+}
+
+func (systemStore) Install(cfg *config.Config) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return installDarwin(cfg)
+	case "linux":
+		return installLinux(cfg)
+	default:
+		return installWindows(cfg)
+	}
+}
+
+func (systemStore) Uninstall(cfg *config.Config) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return uninstallDarwin(cfg)
+	case "linux":
+		return uninstallLinux(cfg)
+	default:
+		return uninstallWindows(cfg)
+	}
+}
+
+// Check asks the platform verifier whether it trusts the root CA.
+func (systemStore) Check(cfg *config.Config) ([]Status, error) {
+	caCert, err := cfg.LoadRootCert()
+	if err != nil {
+		return nil, err
+	}
+	if runtime.GOOS == "linux" {
+		return checkLinux(caCert)
+	}
+	state := StateAbsent
+	if _, err := caCert.Verify(x509.VerifyOptions{}); err == nil {
+		state = StatePresent
+	}
+	return []Status{{Store: "system", Location: runtime.GOOS, State: state}}, nil
+}
@@ -0,0 +1,153 @@
+package truststore_test
+
+import (
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/appremon/apprecert/truststore"
+	"github.com/appremon/apprecert/truststore/trusttest"
+)
+
+const debianAnchorDir = "/usr/local/share/ca-certificates"
+
+// debian makes the test root look like Debian with update-ca-certificates,
+// and returns the anchor directory.
+func (e *env) debian(t *testing.T) string {
+	t.Helper()
+	writeFile(t, e.hostFile("/etc/os-release"), []byte("ID=debian\n"))
+	dir := e.hostFile(debianAnchorDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	e.r.Provide("update-ca-certificates")
+	return dir
+}
+
+// anchors returns the names of the files in the anchor directory.
+func anchors(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestSystemInstallUninstall(t *testing.T) {
+	e := newEnv(t)
+	dir := e.debian(t)
+
+	e.install(t, "system")
+	names := anchors(t, dir)
+	if len(names) != 1 || !strings.HasPrefix(names[0], "apprecert-") {
+		t.Fatalf("anchors %q, want one apprecert-<fingerprint>.crt", names)
+	}
+	if readFile(t, filepath.Join(dir, names[0])) != string(rootPEM(t, e.cfg)) {
+		t.Fatal("anchor does not hold the root CA")
+	}
+	if cmds := e.r.Commands(); len(cmds) != 1 || cmds[0] != "update-ca-certificates" {
+		t.Fatalf("commands %q, want [update-ca-certificates]", cmds)
+	}
+	if state := e.state(t, "system"); state != truststore.StatePresent {
+		t.Fatalf("state %s after install, want present", state)
+	}
+	e.reinstall(t, "system")
+
+	e.r.Reset()
+	e.uninstall(t, "system")
+	if names := anchors(t, dir); len(names) != 0 {
+		t.Fatalf("anchors %q left after uninstall", names)
+	}
+	if !hasCommand(e.r, "update-ca-certificates") {
+		t.Fatal("trust store not rebuilt after uninstall")
+	}
+	if state := e.state(t, "system"); state != truststore.StateAbsent {
+		t.Fatalf("state %s after uninstall, want absent", state)
+	}
+}
+
+func TestSystemInstallReplacesLegacyAnchor(t *testing.T) {
+	e := newEnv(t)
+	dir := e.debian(t)
+	writeFile(t, filepath.Join(dir, "rootCA.crt"), rootPEM(t, e.cfg))
+
+	e.install(t, "system")
+	for _, name := range anchors(t, dir) {
+		if name == "rootCA.crt" {
+			t.Fatal("legacy anchor left behind")
+		}
+	}
+}
+
+func TestSystemUninstallRemovesStaleAnchors(t *testing.T) {
+	e := newEnv(t)
+	dir := e.debian(t)
+	// An anchor of a recreated CA, and one of another CA under our prefix
+	writeFile(t, filepath.Join(dir, "apprecert-0123456789abcdef.crt"), rootPEM(t, newCA(t)))
+	foreign := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: otherCert(t).Raw})
+	writeFile(t, filepath.Join(dir, "apprecert-foreign.crt"), foreign)
+
+	e.install(t, "system")
+	e.uninstall(t, "system")
+	if names := anchors(t, dir); len(names) != 1 || names[0] != "apprecert-foreign.crt" {
+		t.Fatalf("anchors %q after uninstall, want only apprecert-foreign.crt", names)
+	}
+}
+
+func TestSystemRefreshFailure(t *testing.T) {
+	e := newEnv(t)
+	dir := e.debian(t)
+	e.r.On(trusttest.Response{Stderr: "cannot rebuild", ExitCode: 1}, "update-ca-certificates")
+
+	// Rebuilding fails during the rollback too, so the journal is kept
+	results, err := truststore.Install(e.cfg, truststore.Selection{Only: []string{"system"}})
+	if err == nil || results.Err() == nil {
+		t.Fatalf("Install: got %v, %v; want the update-ca-certificates failure and a failed rollback", err, results.Err())
+	}
+	if names := anchors(t, dir); len(names) != 0 {
+		t.Fatalf("anchors %q left after rollback", names)
+	}
+
+	e.r.On(trusttest.Response{}, "update-ca-certificates")
+	e.r.Reset()
+	if err := truststore.Rollback(e.cfg); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if cmds := e.r.Commands(); len(cmds) != 1 || cmds[0] != "update-ca-certificates" {
+		t.Fatalf("commands %q, want [update-ca-certificates]", cmds)
+	}
+	if err := truststore.Rollback(e.cfg); !errors.Is(err, truststore.ErrNoJournal) {
+		t.Fatalf("second Rollback: got %v, want ErrNoJournal", err)
+	}
+}
+
+func TestSystemUninstallRefreshFailure(t *testing.T) {
+	e := newEnv(t)
+	e.debian(t)
+	e.install(t, "system")
+	e.r.On(trusttest.Response{Stderr: "cannot rebuild", ExitCode: 1}, "update-ca-certificates")
+
+	results, err := truststore.Uninstall(e.cfg, truststore.Selection{Only: []string{"system"}})
+	if err != nil {
+		t.Fatalf("Uninstall: %v", err)
+	}
+	if results.Err() == nil {
+		t.Fatal("Uninstall succeeded although update-ca-certificates failed")
+	}
+}
+
+func TestSystemNixOS(t *testing.T) {
+	e := newEnv(t)
+	writeFile(t, e.hostFile("/etc/os-release"), []byte("ID=nixos\n"))
+	if _, err := truststore.Install(e.cfg, truststore.Selection{Only: []string{"system"}}); err == nil || !strings.Contains(err.Error(), "NixOS") {
+		t.Fatalf("Install: got %v, want the NixOS instructions", err)
+	}
+}
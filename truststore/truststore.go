@@ -1,121 +1,163 @@
 package truststore
 
 import (
-	"runtime"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/appremon/apprecert/config"
 )
 
-func Install(cfg *config.Config) error {
-	// Platform-specific installations
-	if runtime.GOOS == "darwin" {
-		if err := installDarwin(cfg); err != nil {
-			return err
-		}
-	} else if runtime.GOOS == "linux" {
-		if err := installLinux(cfg); err != nil {
-			return err
-		}
-	} else if runtime.GOOS == "windows" {
-		if err := installWindows(cfg); err != nil {
-			return err
-		}
+// Selection chooses the stores Install and Uninstall touch. The zero value
+// selects every registered store.
+type Selection struct {
+	Only []string // if set, only these stores; an unavailable one is an error
+	Skip []string // stores to leave alone
+}
+
+// Install adds the root CA to the selected stores. Stores whose tooling is
+// absent are skipped; an explicitly selected one is an error before anything
+// is changed. A failing store does not stop the others; the returned results
+// report the outcome for each store.
+//
+// Install is transactional: every change, including settings stores save in
+// config.json, is journaled in CAROOT, and if any store fails, the changes of
+// all stores are reverted in reverse order. If
+// the rollback itself fails, the journal is kept for Rollback.
+func Install(cfg *config.Config, sel Selection) (Results, error) {
+	if err := requireRootCA(cfg); err != nil {
+		return nil, err
+	}
+	if err := sel.validate(); err != nil {
+		return nil, err
+	}
+	if err := sel.detectOnly(cfg); err != nil {
+		return nil, err
 	}
 
-	// Kubernetes trust store
-	if err := InstallKubernetes(cfg); err != nil {
-		return err
+	runner := CurrentRunner()
+	if _, dryRun := runner.(*Recorder); dryRun {
+		return forEachStore(cfg, sel, Store.Install)
 	}
 
-	// Docker trust store
-	if err := UpdateDockerTrust(cfg); err != nil {
-		return err
+	j, err := beginJournal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	saved := *cfg
+	SetRunner(journalRunner{Runner: runner, j: j})
+	results, err := forEachStore(cfg, sel, func(s Store, cfg *config.Config) error {
+		j.setStore(s.Name())
+		return s.Install(cfg)
+	})
+	SetRunner(runner)
+	if err != nil {
+		return nil, err
 	}
 
-	// Git trust store
-	if err := ConfigureGit(cfg); err != nil {
-		return err
+	if results.Err() == nil {
+		return results, j.remove()
 	}
+	for i := range results {
+		if !results[i].Skipped {
+			results[i].RolledBack = true
+		}
+	}
+	// The rollback restores config.json; forget the settings stores made too
+	*cfg = saved
+	if err := j.rollback(runner); err != nil {
+		return results, fmt.Errorf("rollback failed, run 'apprecert rollback' to retry: %w", err)
+	}
+	return results, j.remove()
+}
 
-	// Node.js trust store
-	if err := ConfigureNodeJS(cfg); err != nil {
-		return err
+// Uninstall removes the root CA from the selected stores, continuing past
+// failures like Install.
+func Uninstall(cfg *config.Config, sel Selection) (Results, error) {
+	if err := requireRootCA(cfg); err != nil {
+		return nil, err
 	}
+	return forEachStore(cfg, sel, Store.Uninstall)
+}
 
-	// Java trust store
-	javaStore, err := NewJavaTrustStore()
-	if err == nil {
-		if err := javaStore.Install(cfg); err != nil {
-			return err
-		}
+// forEachStore runs op on every selected, detected store and collects the results.
+func forEachStore(cfg *config.Config, sel Selection, op func(Store, *config.Config) error) (Results, error) {
+	if err := sel.validate(); err != nil {
+		return nil, err
 	}
 
-	// NSS profiles
-	nssProfiles, err := FindNSSProfiles()
-	if err == nil {
-		for _, profile := range nssProfiles {
-			if err := profile.Install(cfg); err != nil {
-				return err
+	var results Results
+	for _, s := range Stores() {
+		name := s.Name()
+		if !sel.includes(name) {
+			continue
+		}
+		if err := s.Detect(cfg); err != nil {
+			if len(sel.Only) > 0 {
+				// Explicitly requested, so unavailability is a failure
+				results = append(results, Result{Store: name, Err: fmt.Errorf("not available: %w", err)})
+			} else {
+				results = append(results, Result{Store: name, Skipped: true, Err: err})
 			}
+			continue
 		}
+		takeNotes()
+		err := op(s, cfg)
+		results = append(results, Result{Store: name, Err: err, Notes: takeNotes()})
 	}
+	return results, nil
+}
 
+// validate rejects unknown store names.
+func (sel Selection) validate() error {
+	for _, name := range append(append([]string(nil), sel.Only...), sel.Skip...) {
+		if _, ok := Lookup(name); !ok {
+			return fmt.Errorf("unknown trust store %q (available: %s)", name, strings.Join(StoreNames(), ", "))
+		}
+	}
 	return nil
 }
 
-func Uninstall(cfg *config.Config) error {
-	// Platform-specific uninstallations
-	if runtime.GOOS == "darwin" {
-		if err := uninstallDarwin(cfg); err != nil {
-			return err
+// detectOnly checks that every explicitly selected store is available.
+func (sel Selection) detectOnly(cfg *config.Config) error {
+	var errs []error
+	for _, name := range sel.Only {
+		if !sel.includes(name) {
+			continue
 		}
-	} else if runtime.GOOS == "linux" {
-		if err := uninstallLinux(cfg); err != nil {
-			return err
+		s, _ := Lookup(name)
+		if err := s.Detect(cfg); err != nil {
+			errs = append(errs, fmt.Errorf("%s not available: %w", name, err))
 		}
-	} else if runtime.GOOS == "windows" {
-		if err := uninstallWindows(cfg); err != nil {
-			return err
-		}
-	}
-
-	// Kubernetes trust store
-	if err := UninstallKubernetes(cfg); err != nil {
-		return err
-	}
-
-	// Docker trust store
-	if err := RemoveDockerTrust(cfg); err != nil { // You may need to create a `RemoveDockerTrust` function.
-		return err
 	}
+	return errors.Join(errs...)
+}
 
-	// Git trust store
-	if err := UnconfigureGit(cfg); err != nil { // You may need to create a `UnconfigureGit` function.
-		return err
+// includes reports whether the selection covers the named store.
+func (sel Selection) includes(name string) bool {
+	for _, skip := range sel.Skip {
+		if skip == name {
+			return false
+		}
 	}
-
-	// Node.js trust store
-	if err := UnconfigureNodeJS(cfg); err != nil { // You may need to create a `UnconfigureNodeJS` function.
-		return err
+	if len(sel.Only) == 0 {
+		return true
 	}
-
-	// Java trust store
-	javaStore, err := NewJavaTrustStore()
-	if err == nil {
-		if err := javaStore.Uninstall(); err != nil {
-			return err
+	for _, only := range sel.Only {
+		if only == name {
+			return true
 		}
 	}
+	return false
+}
 
-	// NSS profiles
-	nssProfiles, err := FindNSSProfiles()
-	if err == nil {
-		for _, profile := range nssProfiles {
-			if err := profile.Uninstall(); err != nil {
-				return err
-			}
-		}
+// requireRootCA checks that the root CA certificate exists in CAROOT.
+func requireRootCA(cfg *config.Config) error {
+	certPath := filepath.Join(cfg.CAROOT, "rootCA.pem")
+	if _, err := os.Stat(certPath); os.IsNotExist(err) {
+		return fmt.Errorf("certificate not found at %s (run 'apprecert ca init' first)", certPath)
 	}
-
 	return nil
 }
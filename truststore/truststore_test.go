@@ -0,0 +1,287 @@
+package truststore_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appremon/apprecert/cert"
+	"github.com/appremon/apprecert/config"
+	"github.com/appremon/apprecert/keystore"
+	"github.com/appremon/apprecert/truststore"
+	"github.com/appremon/apprecert/truststore/trusttest"
+)
+
+// env is a test environment: a root CA in a temporary CAROOT, a fake home
+// directory and a scripted runner resolving system paths under root.
+type env struct {
+	cfg  *config.Config
+	r    *trusttest.Runner
+	root string
+	home string
+}
+
+// newEnv sets up an isolated environment, so no test touches the real
+// system or the user's files.
+func newEnv(t *testing.T) *env {
+	t.Helper()
+	e := &env{root: t.TempDir(), home: t.TempDir(), r: trusttest.NewRunner()}
+	t.Setenv("HOME", e.home)
+	t.Setenv("USERPROFILE", e.home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(e.home, ".config"))
+	for _, name := range []string{"SHELL", "ZDOTDIR", "JAVA_HOME", "VIRTUAL_ENV", "CONDA_PREFIX", "WORKON_HOME", "ProgramFiles", "KUBECONFIG"} {
+		t.Setenv(name, "")
+	}
+	t.Cleanup(e.r.Activate(e.root))
+	e.cfg = newCA(t)
+	return e
+}
+
+// newCA creates a root CA in a temporary CAROOT. CAs created by the same
+// user share a subject, like a CA recreated with -force.
+func newCA(t *testing.T) *config.Config {
+	t.Helper()
+	cfg := &config.Config{CAROOT: t.TempDir()}
+	if err := cert.CreateCA(cfg, cert.CAOptions{KeyType: cert.ECDSAP256, NoPassphrase: true}); err != nil {
+		t.Fatalf("CreateCA: %v", err)
+	}
+	return cfg
+}
+
+// rootPEM returns the root certificate of cfg as PEM.
+func rootPEM(t *testing.T, cfg *config.Config) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(cfg.CAROOT, config.RootCertFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// otherCert returns an unrelated CA certificate.
+func otherCert(t *testing.T) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Other CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// hostFile returns the path of a system file under the test root.
+func (e *env) hostFile(path string) string {
+	return filepath.Join(e.root, path)
+}
+
+// writeFile creates a file and its directories.
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFile returns the contents of path, or "" if it does not exist.
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// systemRoots provides the platform bundle that combined bundles start from.
+func (e *env) systemRoots(t *testing.T) string {
+	t.Helper()
+	roots := "# system roots\n"
+	writeFile(t, e.hostFile("/etc/ssl/certs/ca-certificates.crt"), []byte(roots))
+	return roots
+}
+
+func (e *env) install(t *testing.T, stores ...string) truststore.Results {
+	t.Helper()
+	results, err := truststore.Install(e.cfg, truststore.Selection{Only: stores})
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if err := results.Err(); err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	return results
+}
+
+func (e *env) uninstall(t *testing.T, stores ...string) {
+	t.Helper()
+	results, err := truststore.Uninstall(e.cfg, truststore.Selection{Only: stores})
+	if err != nil {
+		t.Fatalf("Uninstall: %v", err)
+	}
+	if err := results.Err(); err != nil {
+		t.Fatalf("Uninstall: %v", err)
+	}
+}
+
+// reinstall installs again and fails if that changes anything.
+func (e *env) reinstall(t *testing.T, stores ...string) {
+	t.Helper()
+	e.r.Reset()
+	e.install(t, stores...)
+	if changes := changes(e.r); len(changes) > 0 {
+		t.Fatalf("second install changed the system: %q", changes)
+	}
+}
+
+// state returns the status of the single location a store reports.
+func (e *env) state(t *testing.T, store string) truststore.State {
+	t.Helper()
+	report, err := truststore.Check(e.cfg, truststore.Selection{Only: []string{store}})
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if len(report.Statuses) != 1 {
+		t.Fatalf("Check reported %d locations, want 1: %+v", len(report.Statuses), report.Statuses)
+	}
+	return report.Statuses[0].State
+}
+
+// changes returns the recorded calls that modify the system.
+func changes(r *trusttest.Runner) []string {
+	var calls []string
+	for _, c := range r.Calls() {
+		if c.Op != "query" {
+			calls = append(calls, c.String())
+		}
+	}
+	return calls
+}
+
+// hasCommand reports whether a command line starting with prefix was run.
+func hasCommand(r *trusttest.Runner, prefix string) bool {
+	for _, cmd := range r.Commands() {
+		if strings.HasPrefix(cmd, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestInstallRejectsUnavailableStoreUpFront(t *testing.T) {
+	e := newEnv(t)
+	e.systemRoots(t)
+	e.r.Provide("git") // but not certutil
+
+	results, err := truststore.Install(e.cfg, truststore.Selection{Only: []string{"git", "nss"}})
+	if err == nil || !strings.Contains(err.Error(), "nss not available") {
+		t.Fatalf("Install: got %v, want nss not available", err)
+	}
+	if len(results) > 0 {
+		t.Fatalf("Install ran stores: %+v", results)
+	}
+	if calls := changes(e.r); len(calls) > 0 {
+		t.Fatalf("Install changed the system: %q", calls)
+	}
+}
+
+func TestInstallSkipsUndetectedStores(t *testing.T) {
+	e := newEnv(t)
+	results, err := truststore.Install(e.cfg, truststore.Selection{Skip: []string{"kubernetes"}})
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	for _, res := range results {
+		if !res.Skipped {
+			t.Errorf("store %s was not skipped: %+v", res.Store, res)
+		}
+	}
+}
+
+func TestInstallRejectsUnknownStore(t *testing.T) {
+	e := newEnv(t)
+	if _, err := truststore.Install(e.cfg, truststore.Selection{Only: []string{"nope"}}); err == nil {
+		t.Fatal("Install accepted an unknown store")
+	}
+}
+
+func TestInstallRollsBackOtherStores(t *testing.T) {
+	e := newEnv(t)
+	roots := e.systemRoots(t)
+	e.nssDB(t)
+	e.r.Provide("git", "certutil").
+		On(trusttest.Response{Stderr: "SEC_ERROR_BAD_DATABASE", ExitCode: 1}, "certutil", "-A")
+
+	results, err := truststore.Install(e.cfg, truststore.Selection{Only: []string{"git", "nss"}})
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if results.Err() == nil {
+		t.Fatal("Install succeeded although certutil failed")
+	}
+	for _, res := range results {
+		if !res.RolledBack {
+			t.Errorf("store %s not rolled back", res.Store)
+		}
+	}
+	if !hasCommand(e.r, "git config --global --unset http.sslCAInfo") {
+		t.Errorf("Git was not rolled back: %q", e.r.Commands())
+	}
+	if bundle := filepath.Join(e.cfg.CAROOT, "git-ca-bundle.pem"); readFile(t, bundle) != "" {
+		t.Error("Git bundle left behind")
+	}
+	if readFile(t, e.hostFile("/etc/ssl/certs/ca-certificates.crt")) != roots {
+		t.Error("system roots changed")
+	}
+	if _, err := os.Stat(filepath.Join(e.cfg.CAROOT, "install-journal.json")); !os.IsNotExist(err) {
+		t.Error("journal left behind after a successful rollback")
+	}
+}
+
+func TestInstallRollbackRemovesCreatedDirs(t *testing.T) {
+	e := newEnv(t)
+	e.systemRoots(t)
+	t.Setenv("SHELL", "/usr/bin/fish")
+	e.jdk(t, &keystore.KeyStore{Format: keystore.JKS}, "s3cret")
+	e.r.Provide("node")
+
+	results, err := truststore.Install(e.cfg, truststore.Selection{Only: []string{"nodejs", "java"}})
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if results.Err() == nil {
+		t.Fatal("Install succeeded with the wrong Java store password")
+	}
+	// ~/.config/fish was created for config.fish, and removed again
+	if _, err := os.Stat(filepath.Join(e.home, ".config")); !os.IsNotExist(err) {
+		t.Errorf("created directory left behind: %v", err)
+	}
+	if entries, _ := os.ReadDir(e.home); len(entries) > 0 {
+		t.Errorf("files left in home: %v", entries)
+	}
+}
@@ -0,0 +1,208 @@
+// Package trusttest provides a scripted truststore.Runner, so the trust
+// stores can be exercised without their tooling or root privileges.
+package trusttest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/appremon/apprecert/truststore"
+)
+
+// Response is the scripted result of a command.
+type Response struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// ExitError is returned for a command scripted with a non-zero exit code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string { return fmt.Sprintf("exit status %d", e.Code) }
+
+// Call is one action recorded by a Runner.
+type Call struct {
+	Op   string   // "run", "query", "write", "remove" or "apply"
+	Sudo bool     // the action would run as root
+	Args []string // the command line, the path, or the action description
+}
+
+func (c Call) String() string {
+	s := c.Op + " " + strings.Join(c.Args, " ")
+	if c.Sudo {
+		s += " (sudo)"
+	}
+	return s
+}
+
+type rule struct {
+	argv []string
+	resp Response
+}
+
+// Runner is a truststore.Runner that executes nothing. Commands get
+// scripted responses, and succeed with no output if none matches. File
+// changes are made on the real filesystem, so point the stores at a
+// temporary directory with truststore.SetRoot. Every call is recorded.
+type Runner struct {
+	mu    sync.Mutex
+	rules []rule
+	paths map[string]string
+	calls []Call
+}
+
+// NewRunner returns a Runner with no scripted commands or tools.
+func NewRunner() *Runner {
+	return &Runner{paths: make(map[string]string)}
+}
+
+// On scripts the response to commands whose command line starts with argv.
+// A leading command name without a slash matches any path to that command.
+// Later rules take precedence.
+func (r *Runner) On(resp Response, argv ...string) *Runner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules = append(r.rules, rule{argv: argv, resp: resp})
+	return r
+}
+
+// Provide makes LookPath find the named tools; all others are missing.
+func (r *Runner) Provide(names ...string) *Runner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range names {
+		r.paths[name] = "/usr/bin/" + name
+	}
+	return r
+}
+
+// Activate makes the stores use r and resolve system paths under root. The
+// returned function restores the previous runner and root.
+func (r *Runner) Activate(root string) (restore func()) {
+	prevRunner := truststore.SetRunner(r)
+	prevRoot := truststore.SetRoot(root)
+	return func() {
+		truststore.SetRunner(prevRunner)
+		truststore.SetRoot(prevRoot)
+	}
+}
+
+// Calls returns the recorded calls in order.
+func (r *Runner) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// Commands returns the command lines of the recorded run calls, i.e. the
+// commands that would have changed the system.
+func (r *Runner) Commands() []string {
+	var cmds []string
+	for _, c := range r.Calls() {
+		if c.Op == "run" {
+			cmds = append(cmds, strings.Join(c.Args, " "))
+		}
+	}
+	return cmds
+}
+
+// Reset forgets the recorded calls but keeps the scripted responses.
+func (r *Runner) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
+
+func (r *Runner) record(c Call) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, c)
+}
+
+// respond returns the response of the last rule matching argv.
+func (r *Runner) respond(argv []string) (Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.rules) - 1; i >= 0; i-- {
+		if matches(r.rules[i].argv, argv) {
+			resp := r.rules[i].resp
+			if resp.ExitCode != 0 {
+				return resp, &ExitError{Code: resp.ExitCode}
+			}
+			return resp, nil
+		}
+	}
+	return Response{}, nil
+}
+
+// matches reports whether argv starts with prefix.
+func matches(prefix, argv []string) bool {
+	if len(prefix) > len(argv) {
+		return false
+	}
+	for i, p := range prefix {
+		a := argv[i]
+		if i == 0 && !strings.Contains(p, "/") {
+			a = filepath.Base(a)
+		}
+		if p != a {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Runner) Run(sudo bool, name string, args ...string) ([]byte, error) {
+	argv := append([]string{name}, args...)
+	r.record(Call{Op: "run", Sudo: sudo, Args: argv})
+	resp, err := r.respond(argv)
+	return []byte(resp.Stdout + resp.Stderr), err
+}
+
+func (r *Runner) Query(name string, args ...string) ([]byte, error) {
+	argv := append([]string{name}, args...)
+	r.record(Call{Op: "query", Args: argv})
+	resp, err := r.respond(argv)
+	if err != nil && resp.Stderr != "" {
+		err = fmt.Errorf("%s: %w", strings.TrimSpace(resp.Stderr), err)
+	}
+	return []byte(resp.Stdout), err
+}
+
+func (r *Runner) LookPath(file string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if path, ok := r.paths[file]; ok {
+		return path, nil
+	}
+	return "", fmt.Errorf("exec: %q: executable file not found in $PATH", file)
+}
+
+func (r *Runner) WriteFile(path string, data []byte, perm os.FileMode, sudo bool) error {
+	r.record(Call{Op: "write", Sudo: sudo, Args: []string{path}})
+	return os.WriteFile(path, data, perm)
+}
+
+func (r *Runner) Remove(path string, sudo bool) error {
+	r.record(Call{Op: "remove", Sudo: sudo, Args: []string{path}})
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Apply records the action and performs it. Actions are in-process changes,
+// such as Kubernetes API calls, which tests redirect to doubles like a fake
+// clientset installed with kube.SetFactory.
+func (r *Runner) Apply(action string, fn func() error) error {
+	r.record(Call{Op: "apply", Args: []string{action}})
+	return fn()
+}
+
+var _ truststore.Runner = (*Runner)(nil)
@@ -58,13 +58,19 @@ func installWindows(cfg *config.Config) error {
 		return err
 	}
 
-	store, err := openWindowsRootStore()
+	err = CurrentRunner().Apply("add "+cert.Subject.CommonName+" to the Windows ROOT store", func() error {
+		store, err := openWindowsRootStore()
+		if err != nil {
+			return err
+		}
+		defer store.close()
+
+		return store.addCert(cert.Raw)
+	})
 	if err != nil {
 		return err
 	}
-	defer store.close()
-
-	return store.addCert(cert.Raw)
+	return recordUndo(false, "certutil", "-user", "-delstore", "Root", cert.SerialNumber.Text(16))
 }
 
 func uninstallWindows(cfg *config.Config) error {
@@ -84,13 +90,15 @@ func uninstallWindows(cfg *config.Config) error {
 		return err
 	}
 
-	store, err := openWindowsRootStore()
-	if err != nil {
-		return err
-	}
-	defer store.close()
+	return CurrentRunner().Apply("remove "+cert.Subject.CommonName+" from the Windows ROOT store", func() error {
+		store, err := openWindowsRootStore()
+		if err != nil {
+			return err
+		}
+		defer store.close()
 
-	return store.deleteCertsWithSerial(cert.SerialNumber)
+		return store.deleteCertsWithSerial(cert.SerialNumber)
+	})
 }
 
 // openWindowsRootStore opens the Windows Root CA certificate store.
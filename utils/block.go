@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Markers around the lines apprecert manages in files it shares with users
+// and other tools, such as CA bundles, shell profiles and the bundles of
+// patched container images. Every format we edit this way treats lines
+// starting with "#" as comments.
+const (
+	BlockBegin = "# BEGIN apprecert"
+	BlockEnd   = "# END apprecert"
+)
+
+// ManagedBlock wraps body in the block markers.
+func ManagedBlock(body string) string {
+	if !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+	return BlockBegin + "\n" + body + BlockEnd + "\n"
+}
+
+// FindBlock returns the byte range of the managed block in data, including
+// the newline after the end marker. A begin marker without an end marker is
+// ignored rather than guessed at.
+func FindBlock(data []byte) (start, end int, ok bool) {
+	start = -1
+	for offset := 0; offset < len(data); {
+		next := LineEnd(data, offset)
+		line := string(bytes.TrimSpace(data[offset:next]))
+		switch {
+		case start < 0 && line == BlockBegin:
+			start = offset
+		case start >= 0 && line == BlockEnd:
+			return start, next, true
+		}
+		offset = next
+	}
+	return 0, 0, false
+}
+
+// LineEnd returns the offset just past the line starting at offset.
+func LineEnd(data []byte, offset int) int {
+	if i := bytes.IndexByte(data[offset:], '\n'); i >= 0 {
+		return offset + i + 1
+	}
+	return len(data)
+}
+
+// SetBlock returns data with the managed block holding body, replacing an
+// existing block in place or appending a new one.
+func SetBlock(data []byte, body string) []byte {
+	if start, end, ok := FindBlock(data); ok {
+		return SpliceBlock(data, start, end, body)
+	}
+	return SpliceBlock(data, len(data), len(data), body)
+}
+
+// SetINIBlock is SetBlock for INI style files: a new block goes before the
+// first [section] header, so its options stay at the top level.
+func SetINIBlock(data []byte, body string) []byte {
+	if start, end, ok := FindBlock(data); ok {
+		return SpliceBlock(data, start, end, body)
+	}
+	for offset := 0; offset < len(data); offset = LineEnd(data, offset) {
+		if bytes.HasPrefix(bytes.TrimSpace(data[offset:LineEnd(data, offset)]), []byte("[")) {
+			return SpliceBlock(data, offset, offset, body)
+		}
+	}
+	return SpliceBlock(data, len(data), len(data), body)
+}
+
+// SpliceBlock replaces data[start:end] with a managed block holding body.
+func SpliceBlock(data []byte, start, end int, body string) []byte {
+	var out []byte
+	out = append(out, data[:start]...)
+	if len(out) > 0 && out[len(out)-1] != '\n' {
+		out = append(out, '\n')
+	}
+	out = append(out, ManagedBlock(body)...)
+	return append(out, data[end:]...)
+}
+
+// RemoveBlock returns data without the managed block and whether it had one.
+func RemoveBlock(data []byte) ([]byte, bool) {
+	start, end, ok := FindBlock(data)
+	if !ok {
+		return data, false
+	}
+	out := append([]byte(nil), data[:start]...)
+	return append(out, data[end:]...), true
+}